@@ -0,0 +1,205 @@
+package picodb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Backend is a custom storage of the key-value pairs of a PicoDb,
+// which replaces the root directory when it is set in the options.
+// Implementations must be safe for concurrent use.
+type Backend interface {
+	// Store sets the value of the given key.
+	Store(key string, val []byte) error
+	// Load returns the value of the given key, or a KeyNotFound
+	// error if the key does not exist.
+	Load(key string) ([]byte, error)
+	// Delete removes the given key. A missing key is not an error.
+	Delete(key string) error
+	// List returns all the keys.
+	List() ([]string, error)
+	// Stat returns information about the given key, or a KeyNotFound
+	// error if the key does not exist.
+	Stat(key string) (KeyInfo, error)
+}
+
+// adapter is a kvs which stores the key-value pairs in a Backend.
+// Updates and commits are serialized, so they are atomic with
+// respect to other updates and commits of the same instance.
+// Expiry times are not supported by a Backend.
+type adapter struct {
+	b  Backend
+	mu *sync.Mutex // serializes updates and commits
+}
+
+// newAdapter returns a kvs storing the key-value pairs in b.
+func newAdapter(b Backend) *adapter {
+	return &adapter{b: b, mu: &sync.Mutex{}}
+}
+
+func (a *adapter) store(key string, val []byte) error {
+	return a.b.Store(key, val)
+}
+
+func (a *adapter) load(key string) ([]byte, error) {
+	return a.b.Load(key)
+}
+
+func (a *adapter) delete(key string) error {
+	return a.b.Delete(key)
+}
+
+func (a *adapter) keys() ([]string, error) {
+	return a.b.List()
+}
+
+func (a *adapter) has(key string) (bool, error) {
+	_, err := a.b.Stat(key)
+	if err != nil {
+		if errors.Is(err, NewKeyNotFound(key)) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (a *adapter) stat(key string) (KeyInfo, error) {
+	info, err := a.b.Stat(key)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	info.Key = key
+	return info, nil
+}
+
+func (a *adapter) update(key string, fn updateFunc) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	exists := true
+	old, err := a.b.Load(key)
+	if err != nil {
+		if !errors.Is(err, NewKeyNotFound(key)) {
+			return err
+		}
+		exists = false
+	}
+	val, err := fn(old, exists)
+	if err != nil {
+		if errors.Is(err, errSkip) {
+			return nil
+		}
+		if errors.Is(err, ErrDelete) {
+			return a.b.Delete(key)
+		}
+		return err
+	}
+	return a.b.Store(key, val)
+}
+
+// commit applies the changes one by one. A Backend has no journal,
+// so the values of the changed keys are loaded first, and restored
+// if a change fails. A crash during the commit may still leave part
+// of the changes applied.
+func (a *adapter) commit(ops []op) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	olds := make([]op, 0, len(ops))
+	for _, o := range ops {
+		val, err := a.b.Load(o.Key)
+		switch {
+		case err == nil:
+			olds = append(olds, op{Key: o.Key, Val: val})
+		case errors.Is(err, NewKeyNotFound(o.Key)):
+			olds = append(olds, op{Key: o.Key, Del: true})
+		default:
+			return err
+		}
+	}
+	for i, o := range ops {
+		if err := a.apply(o); err != nil {
+			return a.rollback(olds[:i], err)
+		}
+	}
+	return nil
+}
+
+// apply a single change to the backend.
+func (a *adapter) apply(o op) error {
+	if o.Del {
+		return a.b.Delete(o.Key)
+	}
+	return a.b.Store(o.Key, o.Val)
+}
+
+// rollback restores the given previous values of the keys in reverse
+// order, after the given error of a commit. If a value cannot be
+// restored, the rest are restored all the same, and the first error
+// of the rollback is reported together with the error of the commit.
+func (a *adapter) rollback(olds []op, err error) error {
+	var rerr error
+	for i := len(olds) - 1; i >= 0; i-- {
+		if e := a.apply(olds[i]); e != nil && rerr == nil {
+			rerr = e
+		}
+	}
+	if rerr != nil {
+		return fmt.Errorf("%w, and rolling back failed: %v", err, rerr)
+	}
+	return err
+}
+
+func (a *adapter) storeStream(key string, r io.Reader) error {
+	val, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return a.b.Store(key, val)
+}
+
+func (a *adapter) loadStream(key string) (io.ReadCloser, error) {
+	val, err := a.b.Load(key)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(val)), nil
+}
+
+// storeTTL stores a key-value pair which never expires,
+// ErrNotSupported is returned for any other expiry time.
+func (a *adapter) storeTTL(key string, val []byte, exp time.Time) error {
+	if !exp.IsZero() {
+		return ErrNotSupported
+	}
+	return a.b.Store(key, val)
+}
+
+// expire only accepts a zero expiry time, as keys never expire,
+// ErrNotSupported is returned for any other expiry time.
+// A KeyNotFound error is returned if the key does not exist.
+func (a *adapter) expire(key string, exp time.Time) error {
+	if !exp.IsZero() {
+		return ErrNotSupported
+	}
+	_, err := a.b.Stat(key)
+	return err
+}
+
+// reap does nothing, as keys never expire.
+func (a *adapter) reap() error {
+	return nil
+}
+
+func (a *adapter) open() error {
+	return nil
+}
+
+// with returns the adapter itself, as a Backend takes no context.
+func (a *adapter) with(ctx context.Context) kvs {
+	return a
+}
@@ -0,0 +1,262 @@
+package picodb
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Backend(t *testing.T) {
+
+	open := func(t *testing.T) (*PicoDb, *testBackend) {
+		b := &testBackend{m: map[string][]byte{}}
+		pico, err := Open(Defaults().WithRootDir("").WithBackend(b))
+		require.NoError(t, err)
+		t.Cleanup(func() { pico.Close() })
+		return pico, b
+	}
+
+	t.Run("store and load", func(t *testing.T) {
+		pico, b := open(t)
+		require.NoError(t, pico.StoreString("foo", "bar"))
+		assert.Equal(t, []byte("bar"), b.m["foo"])
+		s, err := pico.LoadString("foo")
+		require.NoError(t, err)
+		assert.Equal(t, "bar", s)
+		_, err = pico.Load("missing")
+		assert.ErrorIs(t, err, NewKeyNotFound("missing"))
+	})
+
+	t.Run("keys, has and stat", func(t *testing.T) {
+		pico, _ := open(t)
+		require.NoError(t, pico.StoreString("foo", "bar"))
+		require.NoError(t, pico.StoreString("baz", "qux"))
+		keys, err := pico.Keys()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"foo", "baz"}, keys)
+		ok, err := pico.Has("foo")
+		require.NoError(t, err)
+		assert.True(t, ok)
+		ok, err = pico.Has("missing")
+		require.NoError(t, err)
+		assert.False(t, ok)
+		info, err := pico.Stat("foo")
+		require.NoError(t, err)
+		assert.Equal(t, "foo", info.Key)
+		assert.Equal(t, int64(3), info.Size)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		pico, b := open(t)
+		require.NoError(t, pico.StoreString("foo", "bar"))
+		require.NoError(t, pico.Delete("foo"))
+		assert.NotContains(t, b.m, "foo")
+		assert.NoError(t, pico.Delete("missing"))
+	})
+
+	t.Run("streams", func(t *testing.T) {
+		pico, _ := open(t)
+		require.NoError(t, pico.StoreReader("foo", strings.NewReader("bar")))
+		rc, err := pico.LoadReader("foo")
+		require.NoError(t, err)
+		defer rc.Close()
+		b, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(b))
+	})
+
+	t.Run("update", func(t *testing.T) {
+		pico, b := open(t)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, pico.Update("n", func(old []byte, exists bool) ([]byte, error) {
+					return append(old, 'x'), nil
+				}))
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, "xxxxxxxxxx", string(b.m["n"]))
+		require.NoError(t, pico.Update("n", func(old []byte, exists bool) ([]byte, error) {
+			return nil, ErrDelete
+		}))
+		assert.NotContains(t, b.m, "n")
+	})
+
+	t.Run("transaction", func(t *testing.T) {
+		pico, b := open(t)
+		require.NoError(t, pico.StoreString("foo", "bar"))
+		require.NoError(t, pico.Txn(func(tx *Tx) error {
+			tx.StoreString("baz", "qux")
+			tx.Delete("foo")
+			return nil
+		}))
+		assert.Equal(t, map[string][]byte{"baz": []byte("qux")}, b.m)
+	})
+
+	t.Run("failed transaction is rolled back", func(t *testing.T) {
+		pico, b := open(t)
+		require.NoError(t, pico.StoreString("a", "a"))
+		require.NoError(t, pico.StoreString("b", "b"))
+		b.err = errors.New("test")
+		b.fail = func(key string) bool { return key == "c" }
+		err := pico.Txn(func(tx *Tx) error {
+			tx.StoreString("a", "x")
+			tx.Delete("b")
+			tx.StoreString("c", "x")
+			return nil
+		})
+		assert.Equal(t, b.err, err)
+		assert.Equal(t, map[string][]byte{"a": []byte("a"), "b": []byte("b")}, b.m)
+	})
+
+	t.Run("failed rollback is reported", func(t *testing.T) {
+		pico, b := open(t)
+		require.NoError(t, pico.StoreString("a", "a"))
+		b.err = errors.New("test")
+		writes := 0
+		b.fail = func(key string) bool {
+			writes++
+			return writes > 1 // the change of b, and restoring a
+		}
+		err := pico.Txn(func(tx *Tx) error {
+			tx.StoreString("a", "x")
+			tx.StoreString("b", "x")
+			return nil
+		})
+		assert.ErrorIs(t, err, b.err)
+		assert.Contains(t, err.Error(), "rolling back failed")
+		assert.Equal(t, map[string][]byte{"a": []byte("x")}, b.m)
+	})
+
+	t.Run("expiry is not supported", func(t *testing.T) {
+		pico, _ := open(t)
+		assert.ErrorIs(t, pico.StoreWithTTL("foo", []byte("bar"), time.Minute), ErrNotSupported)
+		require.NoError(t, pico.StoreString("foo", "bar"))
+		assert.ErrorIs(t, pico.Expire("foo", time.Minute), ErrNotSupported)
+		assert.NoError(t, pico.Persist("foo"))
+		assert.ErrorIs(t, pico.Persist("missing"), NewKeyNotFound("missing"))
+		assert.NoError(t, pico.Reap())
+	})
+
+	t.Run("buckets are not supported", func(t *testing.T) {
+		pico, _ := open(t)
+		_, err := pico.Bucket("foo")
+		assert.ErrorIs(t, err, ErrNotSupported)
+		_, err = pico.ListBuckets()
+		assert.ErrorIs(t, err, ErrNotSupported)
+		assert.ErrorIs(t, pico.DeleteBucket("foo"), ErrNotSupported)
+	})
+
+	t.Run("errors are passed on", func(t *testing.T) {
+		pico, b := open(t)
+		b.err = errors.New("test")
+		assert.ErrorIs(t, pico.StoreString("foo", "bar"), b.err)
+		_, err := pico.Load("foo")
+		assert.ErrorIs(t, err, b.err)
+		_, err = pico.Has("foo")
+		assert.ErrorIs(t, err, b.err)
+		_, err = pico.Keys()
+		assert.ErrorIs(t, err, b.err)
+	})
+
+	t.Run("caching", func(t *testing.T) {
+		b := &testBackend{m: map[string][]byte{}}
+		pico := New(Defaults().WithBackend(b).WithCaching())
+		defer pico.Close()
+		require.NoError(t, pico.StoreString("foo", "bar"))
+		assert.Equal(t, []byte("bar"), b.m["foo"])
+		delete(b.m, "foo")
+		s, err := pico.LoadString("foo")
+		require.NoError(t, err)
+		assert.Equal(t, "bar", s)
+	})
+
+}
+
+// testBackend is a map based Backend, which fails with err if set.
+// If fail is set as well, only the stores and deletes for which it
+// returns true fail.
+type testBackend struct {
+	mu   sync.Mutex
+	m    map[string][]byte
+	err  error
+	fail func(key string) bool
+}
+
+// failed returns the error of a store or delete of the given key.
+func (b *testBackend) failed(key string) error {
+	if b.fail != nil && !b.fail(key) {
+		return nil
+	}
+	return b.err
+}
+
+func (b *testBackend) Store(key string, val []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.failed(key); err != nil {
+		return err
+	}
+	b.m[key] = val
+	return nil
+}
+
+func (b *testBackend) Load(key string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil && b.fail == nil {
+		return nil, b.err
+	}
+	val, ok := b.m[key]
+	if !ok {
+		return nil, NewKeyNotFound(key)
+	}
+	return val, nil
+}
+
+func (b *testBackend) Delete(key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.failed(key); err != nil {
+		return err
+	}
+	delete(b.m, key)
+	return nil
+}
+
+func (b *testBackend) List() ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil && b.fail == nil {
+		return nil, b.err
+	}
+	keys := make([]string, 0, len(b.m))
+	for key := range b.m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (b *testBackend) Stat(key string) (KeyInfo, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil && b.fail == nil {
+		return KeyInfo{}, b.err
+	}
+	val, ok := b.m[key]
+	if !ok {
+		return KeyInfo{}, NewKeyNotFound(key)
+	}
+	return KeyInfo{Size: int64(len(val)), StoredSize: int64(len(val))}, nil
+}
@@ -0,0 +1,287 @@
+package picodb
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PAX records of the archive entries of keys.
+const (
+	paxKey        = "PICODB.key"        // the key, the entry name is its file name
+	paxCompressed = "PICODB.compressed" // "true" if the contents are compressed
+	paxExpires    = "PICODB.expires"    // expiry time in nanoseconds since the epoch
+)
+
+// Backup writes a tar archive of all the keys to the writer,
+// including the keys of the buckets, which are stored in the
+// directories of the archive. Wrap the writer with a gzip.Writer
+// for a compressed archive.
+// The values are archived as they are stored, so compressed values
+// stay compressed, and the compression and the expiry time of the
+// keys are kept in PAX records.
+// Writes can go on during the backup. The archive holds a consistent
+// snapshot of each bucket, which has either all or none of the
+// changes of a transaction.
+func (p *PicoDb) Backup(w io.Writer) error {
+	if err := p.check(); err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	if err := p.backup(tw, ""); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// backup writes the keys and the buckets of the instance to the
+// archive, with the given directory prefix.
+func (p *PicoDb) backup(tw *tar.Writer, dir string) error {
+	if !p.opt.rooted() {
+		return p.backupKeys(tw, dir)
+	}
+	d := newDirfs(p.opt)
+	if err := d.exists(); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := p.backupSnapshot(tw, dir, d); err != nil {
+		return err
+	}
+	buckets, err := p.ListBuckets()
+	if err != nil {
+		return err
+	}
+	for _, name := range buckets {
+		bdir := dir + name + "/"
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     bdir,
+			Mode:     int64(p.opt.DirMode.Perm()),
+			ModTime:  time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		b, err := p.bucket(name)
+		if err != nil {
+			return err
+		}
+		if err := b.backup(tw, bdir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backupSnapshot writes the keys of the root directory to the archive,
+// from a snapshot of the root directory. A read-only root directory
+// is read as it is, since no snapshot can be created in it.
+func (p *PicoDb) backupSnapshot(tw *tar.Writer, dir string, d *dirfs) error {
+	snap := d
+	if !p.opt.ReadOnly {
+		tmp := path.Join(d.root, tmpPrefix+"snapshot-"+uuid.NewString())
+		defer d.s.removeAll(tmp)
+		var err error
+		snap, err = d.snapshot(tmp)
+		if err != nil {
+			return err
+		}
+	}
+	keys, err := snap.keys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err := p.backupFile(tw, dir, snap, key)
+		if err != nil && !errors.Is(err, NewKeyNotFound(key)) {
+			return err
+		}
+	}
+	return nil
+}
+
+// backupFile writes the file of the given key to the archive.
+// The file is read into memory, so its size is known even if it
+// is replaced meanwhile in a read-only root directory.
+func (p *PicoDb) backupFile(tw *tar.Writer, dir string, d *dirfs, key string) error {
+	exp, err := d.expiry(key)
+	if err != nil {
+		return err
+	}
+	if expired(exp) {
+		return nil
+	}
+	raw := d.s.raw()
+	info, err := raw.stat(d.path(key))
+	if err != nil {
+		return d.readErr(key, err)
+	}
+	b, err := raw.read(d.path(key))
+	if err != nil {
+		return d.readErr(key, err)
+	}
+	return writeEntry(tw, dir+d.enc.encode(key), key, b, info.ModTime, exp, p.opt.Compression, p.opt.FileMode)
+}
+
+// backupKeys writes the keys of a store without a root directory
+// to the archive. The keys are read one by one, so the archive only
+// holds a consistent snapshot if there are no writes meanwhile.
+func (p *PicoDb) backupKeys(tw *tar.Writer, dir string) error {
+	keys, err := p.Keys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		info, err := p.Stat(key)
+		if err == nil {
+			var b []byte
+			if b, err = p.Load(key); err == nil {
+				name := dir + KeyEncodingPercent.encode(key)
+				err = writeEntry(tw, name, key, b, info.ModTime, info.Expires, false, p.opt.FileMode)
+			}
+		}
+		if err != nil && !errors.Is(err, NewKeyNotFound(key)) {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeEntry writes an archive entry of a key with the given name.
+func writeEntry(tw *tar.Writer, name, key string, val []byte, mod, exp time.Time, compressed bool, mode os.FileMode) error {
+	records := map[string]string{
+		paxKey:        key,
+		paxCompressed: strconv.FormatBool(compressed),
+	}
+	if !exp.IsZero() {
+		records[paxExpires] = strconv.FormatInt(exp.UnixNano(), 10)
+	}
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeReg,
+		Name:       name,
+		Size:       int64(len(val)),
+		Mode:       int64(mode.Perm()),
+		ModTime:    mod,
+		Format:     tar.FormatPAX,
+		PAXRecords: records,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(val)
+	return err
+}
+
+// Restore reads a tar archive written by Backup from the reader,
+// and stores its keys, which replace the existing keys with the same
+// name. Other keys are left as they are. The archive may be gzip
+// compressed.
+// The values are stored with the compression of the instance,
+// whatever the compression of the archived values is. Expired keys
+// are not restored.
+// An archive of an uncompressed root directory can be restored as
+// well, in which case the keys are the decoded file names.
+func (p *PicoDb) Restore(r io.Reader) error {
+	if err := p.check(); err != nil {
+		return err
+	}
+	if p.opt.ReadOnly {
+		return ErrReadOnly
+	}
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		z, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer z.Close()
+		r = z
+	} else {
+		r = br
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue // buckets are created by their keys
+		}
+		if err := p.restoreEntry(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// restoreEntry stores the key of the given archive entry.
+// Internal files of an archived root directory are skipped.
+func (p *PicoDb) restoreEntry(hdr *tar.Header, r io.Reader) error {
+	name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+	elems := strings.Split(name, "/")
+	for _, elem := range elems {
+		if internal(elem) {
+			return nil
+		}
+	}
+	base := elems[len(elems)-1]
+	key, ok := hdr.PAXRecords[paxKey]
+	if !ok {
+		var err error
+		if key, err = p.opt.KeyEncoding.decode(base); err != nil {
+			key = base
+		}
+	}
+	var exp time.Time
+	if s, ok := hdr.PAXRecords[paxExpires]; ok {
+		ns, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid expiry of %s: %w", hdr.Name, err)
+		}
+		exp = time.Unix(0, ns)
+		if expired(exp) {
+			return nil
+		}
+	}
+	db := p
+	for _, elem := range elems[:len(elems)-1] {
+		b, err := db.bucket(elem)
+		if err != nil {
+			return err
+		}
+		db = b
+	}
+	if hdr.PAXRecords[paxCompressed] == "true" {
+		z, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer z.Close()
+		r = z
+	}
+	if exp.IsZero() {
+		return db.StoreReader(key, r)
+	}
+	val, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return db.kvs.storeTTL(key, val, exp)
+}
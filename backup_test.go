@@ -0,0 +1,267 @@
+package picodb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Backup(t *testing.T) {
+
+	open := func(t *testing.T, opt *PicoDbOptions) *PicoDb {
+		pico, err := Open(opt)
+		require.NoError(t, err)
+		t.Cleanup(func() { pico.Close() })
+		return pico
+	}
+
+	// fill stores keys with and without expiry, and in nested buckets
+	fill := func(t *testing.T, pico *PicoDb) {
+		require.NoError(t, pico.StoreString("foo", "bar"))
+		require.NoError(t, pico.StoreWithTTL("ttl", []byte("ttl"), time.Hour))
+		require.NoError(t, pico.StoreWithTTL("expired", []byte("expired"), time.Millisecond))
+		b, err := pico.Bucket("bucket")
+		require.NoError(t, err)
+		require.NoError(t, b.StoreString("foo", "baz"))
+		n, err := b.Bucket("nested")
+		require.NoError(t, err)
+		require.NoError(t, n.StoreString("foo", "qux"))
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// verify checks the keys stored by fill
+	verify := func(t *testing.T, pico *PicoDb) {
+		keys, err := pico.Keys()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"foo", "ttl"}, keys)
+		s, err := pico.LoadString("foo")
+		require.NoError(t, err)
+		assert.Equal(t, "bar", s)
+		info, err := pico.Stat("ttl")
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), info.Expires, time.Minute)
+		b, err := pico.Bucket("bucket")
+		require.NoError(t, err)
+		s, err = b.LoadString("foo")
+		require.NoError(t, err)
+		assert.Equal(t, "baz", s)
+		n, err := b.Bucket("nested")
+		require.NoError(t, err)
+		s, err = n.LoadString("foo")
+		require.NoError(t, err)
+		assert.Equal(t, "qux", s)
+	}
+
+	for name, opts := range map[string][2]*PicoDbOptions{
+		"plain":        {Defaults(), Defaults()},
+		"compressed":   {Defaults().WithCompression(), Defaults().WithCompression()},
+		"decompressed": {Defaults().WithCompression(), Defaults()},
+		"sharded":      {Defaults().WithSharding(2, 1), Defaults()},
+		"encoded":      {Defaults().WithKeyEncoding(KeyEncodingBase64), Defaults().WithKeyEncoding(KeyEncodingPercent)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			src := open(t, opts[0].WithRootDir(t.TempDir()))
+			fill(t, src)
+			var buf bytes.Buffer
+			require.NoError(t, src.Backup(&buf))
+
+			dst := open(t, opts[1].WithRootDir(t.TempDir()))
+			require.NoError(t, dst.Restore(&buf))
+			verify(t, dst)
+		})
+	}
+
+	t.Run("gzip archive", func(t *testing.T) {
+		src := open(t, Defaults().WithRootDir(t.TempDir()))
+		fill(t, src)
+		var buf bytes.Buffer
+		z := gzip.NewWriter(&buf)
+		require.NoError(t, src.Backup(z))
+		require.NoError(t, z.Close())
+
+		dst := open(t, Defaults().WithRootDir(t.TempDir()))
+		require.NoError(t, dst.Restore(&buf))
+		verify(t, dst)
+	})
+
+	t.Run("archive entries", func(t *testing.T) {
+		src := open(t, Defaults().WithRootDir(t.TempDir()).WithCompression())
+		fill(t, src)
+		var buf bytes.Buffer
+		require.NoError(t, src.Backup(&buf))
+
+		entries := map[string]*tar.Header{}
+		tr := tar.NewReader(&buf)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			entries[hdr.Name] = hdr
+			if hdr.Name == "foo" {
+				z, err := gzip.NewReader(tr)
+				require.NoError(t, err)
+				b, err := io.ReadAll(z)
+				require.NoError(t, err)
+				assert.Equal(t, "bar", string(b))
+			}
+		}
+		assert.Len(t, entries, 6)
+		for _, name := range []string{"foo", "ttl", "bucket/", "bucket/foo", "bucket/nested/", "bucket/nested/foo"} {
+			assert.Contains(t, entries, name)
+		}
+		assert.Equal(t, "foo", entries["foo"].PAXRecords[paxKey])
+		assert.Equal(t, "true", entries["foo"].PAXRecords[paxCompressed])
+		assert.NotContains(t, entries["foo"].PAXRecords, paxExpires)
+		assert.Contains(t, entries["ttl"].PAXRecords, paxExpires)
+		assert.Equal(t, byte(tar.TypeDir), entries["bucket/"].Typeflag)
+	})
+
+	t.Run("snapshot is removed", func(t *testing.T) {
+		root := t.TempDir()
+		src := open(t, Defaults().WithRootDir(root))
+		fill(t, src)
+		before, err := os.ReadDir(root)
+		require.NoError(t, err)
+		require.NoError(t, src.Backup(io.Discard))
+		after, err := os.ReadDir(root)
+		require.NoError(t, err)
+		for _, e := range after {
+			assert.NotContains(t, e.Name(), "snapshot")
+		}
+		assert.Len(t, after, len(before)+1) // the lock file of the journal
+	})
+
+	t.Run("consistent snapshot", func(t *testing.T) {
+		src := open(t, Defaults().WithRootDir(t.TempDir()))
+		require.NoError(t, src.StoreMany(map[string][]byte{"a": []byte("0"), "b": []byte("0")}))
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 1; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				v := []byte(strconv.Itoa(i))
+				assert.NoError(t, src.Txn(func(tx *Tx) error {
+					tx.Store("a", v)
+					tx.Store("b", v)
+					return nil
+				}))
+			}
+		}()
+		for i := 0; i < 20; i++ {
+			var buf bytes.Buffer
+			require.NoError(t, src.Backup(&buf))
+			dst := New(Defaults().WithInMemory())
+			require.NoError(t, dst.Restore(&buf))
+			vals, err := dst.LoadMany([]string{"a", "b"})
+			require.NoError(t, err)
+			assert.Equal(t, vals["a"], vals["b"])
+			dst.Close()
+		}
+		close(done)
+		wg.Wait()
+	})
+
+	t.Run("missing root directory", func(t *testing.T) {
+		src := New(Defaults().WithRootDir(fmt.Sprintf("%s/missing", t.TempDir())))
+		defer src.Close()
+		var buf bytes.Buffer
+		require.NoError(t, src.Backup(&buf))
+		_, err := tar.NewReader(&buf).Next()
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		root := t.TempDir()
+		fill(t, open(t, Defaults().WithRootDir(root)))
+		before, err := os.ReadDir(root)
+		require.NoError(t, err)
+
+		src := open(t, Defaults().WithRootDir(root).WithReadOnly())
+		var buf bytes.Buffer
+		require.NoError(t, src.Backup(&buf))
+		after, err := os.ReadDir(root)
+		require.NoError(t, err)
+		assert.Equal(t, before, after)
+		assert.ErrorIs(t, src.Restore(&buf), ErrReadOnly)
+
+		dst := open(t, Defaults().WithRootDir(t.TempDir()))
+		require.NoError(t, dst.Restore(&buf))
+		verify(t, dst)
+	})
+
+	t.Run("in memory", func(t *testing.T) {
+		src := open(t, Defaults().WithInMemory())
+		require.NoError(t, src.StoreString("a/b", "c"))
+		require.NoError(t, src.StoreWithTTL("ttl", []byte("ttl"), time.Hour))
+		var buf bytes.Buffer
+		require.NoError(t, src.Backup(&buf))
+
+		dst := open(t, Defaults().WithInMemory())
+		require.NoError(t, dst.Restore(&buf))
+		s, err := dst.LoadString("a/b")
+		require.NoError(t, err)
+		assert.Equal(t, "c", s)
+		info, err := dst.Stat("ttl")
+		require.NoError(t, err)
+		assert.False(t, info.Expires.IsZero())
+	})
+
+	t.Run("restore hand made archive", func(t *testing.T) {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for name, val := range map[string]string{
+			"./foo":               "bar",
+			"../../escape":        "value",
+			ttlDir + "/foo":       "123",
+			tmpPrefix + "foo-123": "partial",
+			"bucket/baz":          "qux",
+		} {
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(val))}))
+			_, err := tw.Write([]byte(val))
+			require.NoError(t, err)
+		}
+		require.NoError(t, tw.Close())
+
+		dst := open(t, Defaults().WithRootDir(t.TempDir()))
+		require.NoError(t, dst.Restore(&buf))
+		keys, err := dst.Keys()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"foo", "escape"}, keys)
+		b, err := dst.Bucket("bucket")
+		require.NoError(t, err)
+		s, err := b.LoadString("baz")
+		require.NoError(t, err)
+		assert.Equal(t, "qux", s)
+	})
+
+	t.Run("restore invalid archive", func(t *testing.T) {
+		dst := open(t, Defaults().WithRootDir(t.TempDir()))
+		assert.Error(t, dst.Restore(bytes.NewReader([]byte("not a tar archive"))))
+	})
+
+	t.Run("closed instance", func(t *testing.T) {
+		pico := New(Defaults().WithInMemory())
+		require.NoError(t, pico.Close())
+		assert.ErrorIs(t, pico.Backup(io.Discard), ErrClosed)
+		assert.ErrorIs(t, pico.Restore(&bytes.Buffer{}), ErrClosed)
+	})
+
+}
@@ -0,0 +1,145 @@
+package picodb
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// BatchError is returned by batch operations if any of the keys failed.
+// Keys not present in Errors were processed successfully.
+type BatchError struct {
+	Errors map[string]error // the error of each failed key
+}
+
+func (e *BatchError) Error() string {
+	keys := make([]string, 0, len(e.Errors))
+	for key := range e.Errors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) == 1 {
+		return fmt.Sprintf("batch failed for key %s: %v", keys[0], e.Errors[keys[0]])
+	}
+	return fmt.Sprintf("batch failed for %d keys, first %s: %v", len(keys), keys[0], e.Errors[keys[0]])
+}
+
+// StoreMany stores all the given key-value pairs.
+// The keys are stored in parallel, and a BatchError is returned
+// if storing any of them failed.
+func (p *PicoDb) StoreMany(vals map[string][]byte) error {
+	return p.StoreManyContext(context.Background(), vals)
+}
+
+// StoreManyContext stores all the given key-value pairs, like StoreMany.
+// Once the context is done, no more keys are stored and the error
+// of the context is returned.
+func (p *PicoDb) StoreManyContext(ctx context.Context, vals map[string][]byte) error {
+	keys := make([]string, 0, len(vals))
+	for key := range vals {
+		keys = append(keys, key)
+	}
+	k := p.kvs.with(ctx)
+	return p.parallel(ctx, keys, func(key string) error {
+		return k.store(key, vals[key])
+	})
+}
+
+// LoadMany loads all the given keys.
+// The keys are loaded in parallel. The values of the keys that could
+// be loaded are returned, even if a BatchError is returned for the
+// rest of the keys. Missing keys are reported with a KeyNotFound error.
+func (p *PicoDb) LoadMany(keys []string) (map[string][]byte, error) {
+	return p.LoadManyContext(context.Background(), keys)
+}
+
+// LoadManyContext loads all the given keys, like LoadMany.
+// Once the context is done, no more keys are loaded, and the values
+// loaded so far are returned with the error of the context.
+func (p *PicoDb) LoadManyContext(ctx context.Context, keys []string) (map[string][]byte, error) {
+	var mu sync.Mutex
+	vals := make(map[string][]byte, len(keys))
+	k := p.kvs.with(ctx)
+	err := p.parallel(ctx, keys, func(key string) error {
+		val, err := k.load(key)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		vals[key] = val
+		return nil
+	})
+	return vals, err
+}
+
+// DeleteMany deletes all the given keys.
+// The keys are deleted in parallel, and a BatchError is returned
+// if deleting any of them failed.
+func (p *PicoDb) DeleteMany(keys []string) error {
+	return p.DeleteManyContext(context.Background(), keys)
+}
+
+// DeleteManyContext deletes all the given keys, like DeleteMany.
+// Once the context is done, no more keys are deleted and the error
+// of the context is returned.
+func (p *PicoDb) DeleteManyContext(ctx context.Context, keys []string) error {
+	return p.parallel(ctx, keys, p.kvs.with(ctx).delete)
+}
+
+// parallel calls fn for each key on a bounded number of goroutines,
+// and collects the errors in a BatchError.
+// Once the context is done, the remaining keys are skipped and
+// the error of the context is returned.
+func (p *PicoDb) parallel(ctx context.Context, keys []string, fn func(string) error) error {
+	if err := p.check(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var mu sync.Mutex
+	errs := make(map[string]error)
+	var wg sync.WaitGroup
+	ch := make(chan string)
+	for i := 0; i < p.workers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range ch {
+				if err := fn(key); err != nil {
+					mu.Lock()
+					errs[key] = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+feed:
+	for _, key := range keys {
+		select {
+		case ch <- key:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(ch)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return &BatchError{Errors: errs}
+	}
+	return nil
+}
+
+// workers returns the number of goroutines used by batch operations.
+func (p *PicoDb) workers() int {
+	if p.opt == nil || p.opt.Workers <= 0 {
+		return runtime.NumCPU()
+	}
+	return p.opt.Workers
+}
@@ -0,0 +1,98 @@
+package picodb
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Batch(t *testing.T) {
+
+	pico := &PicoDb{
+		opt: Defaults().WithWorkers(4),
+		kvs: &cache{m: &sync.Map{}},
+	}
+
+	vals := make(map[string][]byte)
+	keys := []string{}
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		vals[key] = []byte(key)
+		keys = append(keys, key)
+	}
+
+	t.Run("store many", func(t *testing.T) {
+		require.NoError(t, pico.StoreMany(vals))
+		n, err := pico.Count()
+		require.NoError(t, err)
+		assert.Equal(t, len(vals), n)
+	})
+
+	t.Run("load many", func(t *testing.T) {
+		res, err := pico.LoadMany(keys)
+		require.NoError(t, err)
+		assert.Equal(t, vals, res)
+	})
+
+	t.Run("load many with missing keys", func(t *testing.T) {
+		res, err := pico.LoadMany([]string{"1", "missing"})
+		var be *BatchError
+		require.ErrorAs(t, err, &be)
+		assert.Len(t, be.Errors, 1)
+		assert.ErrorIs(t, be.Errors["missing"], NewKeyNotFound("missing"))
+		assert.Equal(t, map[string][]byte{"1": []byte("1")}, res)
+	})
+
+	t.Run("delete many", func(t *testing.T) {
+		require.NoError(t, pico.DeleteMany(keys))
+		n, err := pico.Count()
+		require.NoError(t, err)
+		assert.Zero(t, n)
+	})
+
+	t.Run("empty batch", func(t *testing.T) {
+		assert.NoError(t, pico.StoreMany(nil))
+		res, err := pico.LoadMany(nil)
+		assert.NoError(t, err)
+		assert.Empty(t, res)
+	})
+
+}
+
+func Test_BatchErrors(t *testing.T) {
+	testErr := errors.New("test")
+	pico := &PicoDb{
+		kvs: &testKvs{
+			storeMock: func(key string, val []byte) error {
+				if key == "bad" {
+					return testErr
+				}
+				return nil
+			},
+			deleteMock: func(key string) error {
+				return testErr
+			},
+		},
+	}
+
+	t.Run("store many error", func(t *testing.T) {
+		err := pico.StoreMany(map[string][]byte{"good": nil, "bad": nil})
+		var be *BatchError
+		require.ErrorAs(t, err, &be)
+		assert.Equal(t, map[string]error{"bad": testErr}, be.Errors)
+		assert.Contains(t, err.Error(), "bad")
+	})
+
+	t.Run("delete many error", func(t *testing.T) {
+		err := pico.DeleteMany([]string{"foo", "bar"})
+		var be *BatchError
+		require.ErrorAs(t, err, &be)
+		assert.Len(t, be.Errors, 2)
+		assert.Contains(t, err.Error(), "2 keys")
+	})
+
+}
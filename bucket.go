@@ -0,0 +1,111 @@
+package picodb
+
+import "path"
+
+// Bucket returns a KV holding the keys of the bucket with the given
+// name. The keys of a bucket are stored in a subdirectory of the
+// root directory, which is created on the first store, and they
+// are separate from the keys of the parent and of other buckets.
+// Buckets can be nested, and use the same options as their parent.
+// The same instance is returned for the same name until it is
+// closed, and it is closed together with the parent.
+// A KeyInvalid error is returned if the given name cannot be used
+// as a directory name, or a file other than a directory, such as a
+// symbolic link, has the name.
+// Buckets are not supported with a custom backend or in memory.
+func (p *PicoDb) Bucket(name string) (KV, error) {
+	b, err := p.bucket(name)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// bucket returns the PicoDb of the bucket with the given name,
+// see Bucket.
+func (p *PicoDb) bucket(name string) (*PicoDb, error) {
+	if err := p.checkBuckets(); err != nil {
+		return nil, err
+	}
+	d := newDirfs(p.opt)
+	if err := d.checkBucket(name); err != nil {
+		return nil, err
+	}
+	if err := d.s.checkDir(path.Join(d.root, name)); err != nil {
+		return nil, d.readErr(name, err)
+	}
+	p.bmu.Lock()
+	defer p.bmu.Unlock()
+	// checked again, as a bucket added after closeBuckets is not closed
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	if b, ok := p.buckets[name]; ok && b.check() == nil {
+		return b, nil
+	}
+	opt := *p.opt
+	opt.RootDir = path.Join(p.opt.RootDir, name)
+	b := newPicoDb(&opt)
+	// best effort, the same way as New
+	_ = b.kvs.open()
+	b.start()
+	if p.buckets == nil {
+		p.buckets = make(map[string]*PicoDb)
+	}
+	p.buckets[name] = b
+	return b, nil
+}
+
+// ListBuckets returns the names of the buckets in lexicographic order.
+// Nested buckets are listed by the bucket containing them.
+func (p *PicoDb) ListBuckets() ([]string, error) {
+	if err := p.checkBuckets(); err != nil {
+		return nil, err
+	}
+	return newDirfs(p.opt).buckets()
+}
+
+// DeleteBucket deletes the bucket with the given name, together with
+// all of its keys and nested buckets. The instance returned for the
+// bucket by Bucket is closed.
+// If the bucket does not exist, nothing is deleted and no error is
+// returned.
+// ErrReadOnly is returned in read-only mode.
+func (p *PicoDb) DeleteBucket(name string) error {
+	if err := p.checkBuckets(); err != nil {
+		return err
+	}
+	if p.opt.ReadOnly {
+		return ErrReadOnly
+	}
+	p.bmu.Lock()
+	defer p.bmu.Unlock()
+	if b, ok := p.buckets[name]; ok {
+		_ = b.Close()
+		delete(p.buckets, name)
+	}
+	return newDirfs(p.opt).dropBucket(name)
+}
+
+// checkBuckets returns ErrClosed if the instance is closed, and
+// ErrNotSupported if it has no root directory to hold buckets.
+func (p *PicoDb) checkBuckets() error {
+	if err := p.check(); err != nil {
+		return err
+	}
+	if !p.opt.rooted() {
+		return ErrNotSupported
+	}
+	return nil
+}
+
+// closeBuckets closes the instances of the buckets.
+func (p *PicoDb) closeBuckets() {
+	p.bmu.Lock()
+	defer p.bmu.Unlock()
+	for _, b := range p.buckets {
+		// buckets closed by the caller report ErrClosed
+		_ = b.Close()
+	}
+	p.buckets = nil
+}
@@ -0,0 +1,146 @@
+package picodb
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Bucket(t *testing.T) {
+
+	for name, opt := range map[string]*PicoDbOptions{
+		"default":     Defaults(),
+		"compression": Defaults().WithCompression(),
+		"caching":     Defaults().WithCaching(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			pico := New(opt.WithRootDir(dir))
+			defer pico.Close()
+
+			users, err := pico.Bucket("users")
+			require.NoError(t, err)
+			require.NoError(t, users.StoreString("foo", "bar"))
+			require.NoError(t, pico.StoreString("foo", "baz"))
+
+			s, err := users.LoadString("foo")
+			require.NoError(t, err)
+			assert.Equal(t, "bar", s)
+			s, err = pico.LoadString("foo")
+			require.NoError(t, err)
+			assert.Equal(t, "baz", s)
+
+			keys, err := pico.Keys()
+			require.NoError(t, err)
+			assert.Equal(t, []string{"foo"}, keys)
+			n, err := users.Count()
+			require.NoError(t, err)
+			assert.Equal(t, 1, n)
+
+			_, err = os.Stat(path.Join(dir, "users", "foo"))
+			assert.NoError(t, err)
+		})
+	}
+
+	t.Run("same instance is returned", func(t *testing.T) {
+		pico := New(Defaults().WithRootDir(t.TempDir()))
+		defer pico.Close()
+		b1, err := pico.Bucket("foo")
+		require.NoError(t, err)
+		b2, err := pico.Bucket("foo")
+		require.NoError(t, err)
+		assert.Same(t, b1, b2)
+
+		require.NoError(t, b1.Close())
+		b3, err := pico.Bucket("foo")
+		require.NoError(t, err)
+		assert.NotSame(t, b1, b3)
+	})
+
+	t.Run("nested buckets", func(t *testing.T) {
+		dir := t.TempDir()
+		pico := New(Defaults().WithRootDir(dir))
+		defer pico.Close()
+		foo, err := pico.Bucket("foo")
+		require.NoError(t, err)
+		bar, err := foo.Bucket("bar")
+		require.NoError(t, err)
+		require.NoError(t, bar.StoreString("baz", "qux"))
+		_, err = os.Stat(path.Join(dir, "foo", "bar", "baz"))
+		assert.NoError(t, err)
+
+		names, err := pico.ListBuckets()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"foo"}, names)
+		names, err = foo.ListBuckets()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"bar"}, names)
+	})
+
+	t.Run("list buckets", func(t *testing.T) {
+		pico := New(Defaults().WithRootDir(t.TempDir()))
+		defer pico.Close()
+		names, err := pico.ListBuckets()
+		require.NoError(t, err)
+		assert.Empty(t, names)
+
+		require.NoError(t, pico.StoreWithTTL("foo", nil, time.Hour))
+		for _, name := range []string{"b", "a"} {
+			b, err := pico.Bucket(name)
+			require.NoError(t, err)
+			require.NoError(t, b.StoreString("foo", "bar"))
+		}
+		names, err = pico.ListBuckets()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, names)
+	})
+
+	t.Run("delete bucket", func(t *testing.T) {
+		dir := t.TempDir()
+		pico := New(Defaults().WithRootDir(dir))
+		defer pico.Close()
+		b, err := pico.Bucket("foo")
+		require.NoError(t, err)
+		require.NoError(t, b.StoreString("foo", "bar"))
+
+		require.NoError(t, pico.DeleteBucket("foo"))
+		assert.ErrorIs(t, b.StoreString("foo", "bar"), ErrClosed)
+		_, err = os.Stat(path.Join(dir, "foo"))
+		assert.True(t, os.IsNotExist(err))
+		assert.NoError(t, pico.DeleteBucket("foo"))
+
+		b, err = pico.Bucket("foo")
+		require.NoError(t, err)
+		n, err := b.Count()
+		require.NoError(t, err)
+		assert.Zero(t, n)
+	})
+
+	t.Run("invalid names", func(t *testing.T) {
+		pico := New(Defaults().WithRootDir(t.TempDir()))
+		defer pico.Close()
+		for _, name := range []string{"", ".", "..", path.Join("foo", "bar"), ttlDir} {
+			_, err := pico.Bucket(name)
+			assert.ErrorIs(t, err, NewKeyInvalid(name))
+			assert.ErrorIs(t, pico.DeleteBucket(name), NewKeyInvalid(name))
+		}
+	})
+
+	t.Run("buckets are closed with the parent", func(t *testing.T) {
+		pico := New(Defaults().WithRootDir(t.TempDir()))
+		b, err := pico.Bucket("foo")
+		require.NoError(t, err)
+		require.NoError(t, pico.Close())
+		assert.ErrorIs(t, b.StoreString("foo", "bar"), ErrClosed)
+		_, err = pico.Bucket("foo")
+		assert.ErrorIs(t, err, ErrClosed)
+		_, err = pico.ListBuckets()
+		assert.ErrorIs(t, err, ErrClosed)
+		assert.ErrorIs(t, pico.DeleteBucket("foo"), ErrClosed)
+	})
+
+}
@@ -1,26 +1,174 @@
 package picodb
 
-import "sync"
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
 
 // cache is a thread safe in-memory key-value store
 type cache struct {
-	m *sync.Map
+	m  *sync.Map
+	mu sync.Mutex // serializes writes
+}
+
+// entry is a value held by the cache
+type entry struct {
+	val []byte    // the value
+	mod time.Time // time the value was stored
+	exp time.Time // expiry time, zero if the value never expires
 }
 
 func (c *cache) store(key string, val []byte) error {
-	c.m.Store(key, val)
+	return c.storeTTL(key, val, time.Time{})
+}
+
+func (c *cache) storeTTL(key string, val []byte, exp time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.m.Store(key, &entry{val: val, mod: time.Now(), exp: exp})
 	return nil
 }
 
 func (c *cache) load(key string) ([]byte, error) {
-	val, ok := c.m.Load(key)
+	e, ok := c.get(key)
 	if !ok {
 		return nil, NewKeyNotFound(key)
 	}
-	return val.([]byte), nil
+	return e.val, nil
 }
 
 func (c *cache) delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.m.Delete(key)
 	return nil
 }
+
+func (c *cache) keys() ([]string, error) {
+	keys := []string{}
+	c.m.Range(func(key, e interface{}) bool {
+		if !expired(e.(*entry).exp) {
+			keys = append(keys, key.(string))
+		}
+		return true
+	})
+	return keys, nil
+}
+
+func (c *cache) has(key string) (bool, error) {
+	_, ok := c.get(key)
+	return ok, nil
+}
+
+func (c *cache) stat(key string) (KeyInfo, error) {
+	e, ok := c.get(key)
+	if !ok {
+		return KeyInfo{}, NewKeyNotFound(key)
+	}
+	size := int64(len(e.val))
+	return KeyInfo{
+		Key:        key,
+		Size:       size,
+		StoredSize: size,
+		ModTime:    e.mod,
+		Expires:    e.exp,
+	}, nil
+}
+
+func (c *cache) update(key string, fn updateFunc) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var old []byte
+	var exp time.Time
+	e, exists := c.get(key)
+	if exists {
+		old, exp = e.val, e.exp
+	}
+	val, err := fn(old, exists)
+	if err != nil {
+		if errors.Is(err, errSkip) {
+			return nil
+		}
+		if errors.Is(err, ErrDelete) {
+			c.m.Delete(key)
+			return nil
+		}
+		return err
+	}
+	c.m.Store(key, &entry{val: val, mod: time.Now(), exp: exp})
+	return nil
+}
+
+func (c *cache) expire(key string, exp time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.get(key)
+	if !ok {
+		return NewKeyNotFound(key)
+	}
+	c.m.Store(key, &entry{val: e.val, mod: e.mod, exp: exp})
+	return nil
+}
+
+func (c *cache) reap() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.m.Range(func(key, e interface{}) bool {
+		if expired(e.(*entry).exp) {
+			c.m.Delete(key)
+		}
+		return true
+	})
+	return nil
+}
+
+func (c *cache) commit(ops []op) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, o := range ops {
+		if o.Del {
+			c.m.Delete(o.Key)
+		} else {
+			c.m.Store(o.Key, &entry{val: o.Val, mod: time.Now()})
+		}
+	}
+	return nil
+}
+
+func (c *cache) storeStream(key string, r io.Reader) error {
+	val, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return c.store(key, val)
+}
+
+func (c *cache) loadStream(key string) (io.ReadCloser, error) {
+	val, err := c.load(key)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(val)), nil
+}
+
+func (c *cache) open() error {
+	return nil
+}
+
+// with returns the cache itself, as it never blocks.
+func (c *cache) with(ctx context.Context) kvs {
+	return c
+}
+
+// get returns the entry of the key, unless it is missing or expired.
+func (c *cache) get(key string) (*entry, bool) {
+	e, ok := c.m.Load(key)
+	if !ok || expired(e.(*entry).exp) {
+		return nil, false
+	}
+	return e.(*entry), true
+}
@@ -1,8 +1,11 @@
 package picodb
 
 import (
+	"bytes"
+	"io"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -41,4 +44,116 @@ func Test_Cache(t *testing.T) {
 		assert.NoError(t, c.delete("asd"))
 	})
 
+	t.Run("has", func(t *testing.T) {
+		require.NoError(t, c.store("baz", []byte{}))
+		ok, err := c.has("baz")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		ok, err = c.has("missing")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("stat", func(t *testing.T) {
+		require.NoError(t, c.store("baz", []byte{1, 2}))
+		info, err := c.stat("baz")
+		assert.NoError(t, err)
+		assert.Equal(t, "baz", info.Key)
+		assert.Equal(t, int64(2), info.Size)
+		assert.Equal(t, int64(2), info.StoredSize)
+		assert.False(t, info.ModTime.IsZero())
+		_, err = c.stat("missing")
+		assert.ErrorIs(t, err, NewKeyNotFound("missing"))
+	})
+
+	t.Run("update", func(t *testing.T) {
+		require.NoError(t, c.store("counter", []byte{1}))
+		err := c.update("counter", func(old []byte, exists bool) ([]byte, error) {
+			assert.True(t, exists)
+			return append(old, 2), nil
+		})
+		assert.NoError(t, err)
+		val, err := c.load("counter")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{1, 2}, val)
+	})
+
+	t.Run("skip update", func(t *testing.T) {
+		err := c.update("skipped", func(old []byte, exists bool) ([]byte, error) {
+			assert.False(t, exists)
+			return nil, errSkip
+		})
+		assert.NoError(t, err)
+		_, err = c.load("skipped")
+		assert.ErrorIs(t, err, NewKeyNotFound("skipped"))
+	})
+
+	t.Run("delete with update", func(t *testing.T) {
+		require.NoError(t, c.store("deleted", []byte{}))
+		err := c.update("deleted", func(old []byte, exists bool) ([]byte, error) {
+			return nil, ErrDelete
+		})
+		assert.NoError(t, err)
+		_, err = c.load("deleted")
+		assert.ErrorIs(t, err, NewKeyNotFound("deleted"))
+	})
+
+	t.Run("commit", func(t *testing.T) {
+		require.NoError(t, c.store("old", []byte{}))
+		err := c.commit([]op{{Key: "new", Val: []byte{1}}, {Key: "old", Del: true}})
+		assert.NoError(t, err)
+		val, err := c.load("new")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{1}, val)
+		_, err = c.load("old")
+		assert.ErrorIs(t, err, NewKeyNotFound("old"))
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		require.NoError(t, c.storeStream("stream", bytes.NewReader([]byte{1, 2})))
+		rc, err := c.loadStream("stream")
+		require.NoError(t, err)
+		b, err := io.ReadAll(rc)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{1, 2}, b)
+		_, err = c.loadStream("missing")
+		assert.ErrorIs(t, err, NewKeyNotFound("missing"))
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		c := &cache{m: &sync.Map{}}
+		require.NoError(t, c.storeTTL("live", []byte{1}, time.Now().Add(time.Hour)))
+		require.NoError(t, c.storeTTL("expired", []byte{1}, time.Now().Add(-time.Second)))
+
+		_, err := c.load("expired")
+		assert.ErrorIs(t, err, NewKeyNotFound("expired"))
+		ok, err := c.has("expired")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		keys, err := c.keys()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"live"}, keys)
+		assert.ErrorIs(t, c.expire("expired", time.Time{}), NewKeyNotFound("expired"))
+
+		require.NoError(t, c.expire("live", time.Time{}))
+		info, err := c.stat("live")
+		assert.NoError(t, err)
+		assert.True(t, info.Expires.IsZero())
+
+		require.NoError(t, c.reap())
+		_, ok = c.m.Load("expired")
+		assert.False(t, ok)
+		_, ok = c.m.Load("live")
+		assert.True(t, ok)
+	})
+
+	t.Run("keys", func(t *testing.T) {
+		c := &cache{m: &sync.Map{}}
+		require.NoError(t, c.store("foo", []byte{}))
+		require.NoError(t, c.store("bar", []byte{}))
+		keys, err := c.keys()
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"foo", "bar"}, keys)
+	})
+
 }
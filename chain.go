@@ -1,6 +1,11 @@
 package picodb
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
 
 // chain is special kvs which can handle chain between
 // multiple kvs' in case of missing keys
@@ -58,3 +63,227 @@ func (f *chain) delete(key string) error {
 	}
 	return nil
 }
+
+// keys returns the union of the keys of all underlying kvs
+// Keys present in more than one kvs are only listed once.
+// In case of an error the operation fails and the error
+// is returned immediately.
+func (f *chain) keys() ([]string, error) {
+	seen := make(map[string]bool)
+	keys := []string{}
+	for _, s := range f.list {
+		k, err := s.keys()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range k {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// has reports whether any of the underlying kvs contains the key
+// The kvs are asked in order, so the key is looked up in the
+// later ones only if the earlier ones do not have it.
+func (f *chain) has(key string) (bool, error) {
+	for _, s := range f.list {
+		ok, err := s.has(key)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// stat returns information about the key from the last kvs that
+// contains it, which is the one closest to the actual storage.
+// If the key is not present in any of them, a
+// KeyNotFound error is returned.
+func (f *chain) stat(key string) (KeyInfo, error) {
+	notfound := NewKeyNotFound(key)
+	for i := len(f.list) - 1; i >= 0; i-- {
+		info, err := f.list[i].stat(key)
+		if err != nil {
+			if errors.Is(err, notfound) {
+				continue
+			}
+			return KeyInfo{}, err
+		}
+		return info, nil
+	}
+	return KeyInfo{}, notfound
+}
+
+// update performs the update on the last kvs, which is the one
+// closest to the actual storage, and then removes the key from
+// the rest of the kvs, since they may not know its expiry.
+// In case of an error the operation fails and the error
+// is returned immediately.
+func (f *chain) update(key string, fn updateFunc) error {
+	if len(f.list) == 0 {
+		return nil
+	}
+	changed := false
+	last := f.list[len(f.list)-1]
+	err := last.update(key, func(old []byte, exists bool) ([]byte, error) {
+		v, err := fn(old, exists)
+		changed = err == nil || errors.Is(err, ErrDelete)
+		return v, err
+	})
+	if err != nil || !changed {
+		return err
+	}
+	for _, s := range f.list[:len(f.list)-1] {
+		if err := s.delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit applies the changes atomically on the last kvs, which is
+// the one closest to the actual storage, and then on the rest of
+// the kvs.
+// If the last kvs fails, some of the changes may have been applied
+// to it, so the changed keys are removed from the rest of the kvs,
+// which would serve stale values otherwise.
+// In case of an error the operation fails and the error
+// is returned immediately.
+func (f *chain) commit(ops []op) error {
+	if len(f.list) == 0 {
+		return nil
+	}
+	if err := f.list[len(f.list)-1].commit(ops); err != nil {
+		f.evict(ops)
+		return err
+	}
+	for _, s := range f.list[:len(f.list)-1] {
+		if err := s.commit(ops); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evict removes the keys of the changes from every kvs but the last.
+// Missing keys and errors are ignored, as it is only called on
+// failure.
+func (f *chain) evict(ops []op) {
+	for _, s := range f.list[:len(f.list)-1] {
+		for _, o := range ops {
+			s.delete(o.Key)
+		}
+	}
+}
+
+// storeStream streams the value into the last kvs, which is the one
+// closest to the actual storage, and removes the key from the rest
+// of the kvs instead of buffering the value for them.
+// In case of an error the operation fails and the error
+// is returned immediately.
+func (f *chain) storeStream(key string, r io.Reader) error {
+	if len(f.list) == 0 {
+		return nil
+	}
+	if err := f.list[len(f.list)-1].storeStream(key, r); err != nil {
+		return err
+	}
+	for _, s := range f.list[:len(f.list)-1] {
+		if err := s.delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadStream opens the key from the first kvs that contains it
+// If the key is not present in any of them, a
+// KeyNotFound error is returned.
+func (f *chain) loadStream(key string) (io.ReadCloser, error) {
+	notfound := NewKeyNotFound(key)
+	for _, s := range f.list {
+		rc, err := s.loadStream(key)
+		if err != nil {
+			if errors.Is(err, notfound) {
+				continue
+			}
+			return nil, err
+		}
+		return rc, nil
+	}
+	return nil, notfound
+}
+
+// storeTTL adds the expiring key-value pair to every underlying kvs
+// If any store operation fails, the operation fails
+// and the error is immediately returned.
+func (f *chain) storeTTL(key string, val []byte, exp time.Time) error {
+	for _, s := range f.list {
+		if err := s.storeTTL(key, val, exp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expire sets the expiry time of the key in the last kvs, which is
+// the one closest to the actual storage, and then in the rest of
+// the kvs which contain the key.
+// If the last kvs does not contain the key, a KeyNotFound
+// error is returned.
+func (f *chain) expire(key string, exp time.Time) error {
+	if len(f.list) == 0 {
+		return NewKeyNotFound(key)
+	}
+	if err := f.list[len(f.list)-1].expire(key, exp); err != nil {
+		return err
+	}
+	notfound := NewKeyNotFound(key)
+	for _, s := range f.list[:len(f.list)-1] {
+		err := s.expire(key, exp)
+		if err != nil && !errors.Is(err, notfound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// reap deletes the expired keys from all underlying kvs
+// In case of an error the operation fails and the error
+// is returned immediately.
+func (f *chain) reap() error {
+	for _, s := range f.list {
+		if err := s.reap(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// open opens all underlying kvs
+// In case of an error the operation fails and the error
+// is returned immediately.
+func (f *chain) open() error {
+	for _, s := range f.list {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// with returns a chain of the underlying kvs bound to the given context.
+func (f *chain) with(ctx context.Context) kvs {
+	list := make([]kvs, len(f.list))
+	for i, s := range f.list {
+		list[i] = s.with(ctx)
+	}
+	return &chain{list: list}
+}
@@ -1,9 +1,13 @@
 package picodb
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"io"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -55,6 +59,73 @@ func Test_Chain(t *testing.T) {
 		assert.ErrorIs(t, err, NewKeyNotFound(key))
 	})
 
+	t.Run("stream into last kvs", func(t *testing.T) {
+		key := "stream"
+		require.NoError(t, c1.store(key, []byte{0}))
+		require.NoError(t, chain.storeStream(key, bytes.NewReader([]byte{1})))
+
+		_, err := c1.load(key)
+		assert.ErrorIs(t, err, NewKeyNotFound(key))
+
+		rc, err := chain.loadStream(key)
+		require.NoError(t, err)
+		b, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{1}, b)
+
+		require.NoError(t, chain.delete(key))
+		_, err = chain.loadStream(key)
+		assert.ErrorIs(t, err, NewKeyNotFound(key))
+	})
+
+	t.Run("keys are merged without duplicates", func(t *testing.T) {
+		require.NoError(t, c1.store("qux", nil))
+		require.NoError(t, c2.store("qux", nil))
+
+		keys, err := chain.keys()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"foo", "bar", "qux"}, keys)
+	})
+
+	t.Run("update invalidates other kvs", func(t *testing.T) {
+		key := "upd"
+		require.NoError(t, c1.store(key, []byte{1}))
+		require.NoError(t, c2.store(key, []byte{1}))
+		err := chain.update(key, func(old []byte, exists bool) ([]byte, error) {
+			return append(old, 2), nil
+		})
+		require.NoError(t, err)
+
+		_, err = c1.load(key)
+		assert.ErrorIs(t, err, NewKeyNotFound(key))
+
+		v2, err := c2.load(key)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{1, 2}, v2)
+	})
+
+	t.Run("delete with update is propagated", func(t *testing.T) {
+		key := "upd"
+		err := chain.update(key, func(old []byte, exists bool) ([]byte, error) {
+			return nil, ErrDelete
+		})
+		require.NoError(t, err)
+		_, err = c1.load(key)
+		assert.ErrorIs(t, err, NewKeyNotFound(key))
+		_, err = c2.load(key)
+		assert.ErrorIs(t, err, NewKeyNotFound(key))
+	})
+
+	t.Run("skipped update is not propagated", func(t *testing.T) {
+		key := "skip"
+		err := chain.update(key, func(old []byte, exists bool) ([]byte, error) {
+			return nil, errSkip
+		})
+		require.NoError(t, err)
+		_, err = c1.load(key)
+		assert.ErrorIs(t, err, NewKeyNotFound(key))
+	})
+
 }
 
 func Test_ChainErrors(t *testing.T) {
@@ -105,6 +176,168 @@ func Test_ChainErrors(t *testing.T) {
 		assert.ErrorIs(t, err, notfound)
 	})
 
+	t.Run("error during keys", func(t *testing.T) {
+		defer c1.reset()
+		defer c2.reset()
+		c2.keysMock = func() ([]string, error) { return nil, testErr }
+		_, err := chain.keys()
+		assert.ErrorIs(t, err, testErr)
+	})
+
+	t.Run("has asks kvs in order", func(t *testing.T) {
+		defer c1.reset()
+		defer c2.reset()
+		c1.hasMock = func(s string) (bool, error) { return true, nil }
+		c2.hasMock = func(s string) (bool, error) { return false, testErr }
+		ok, err := chain.has("foo")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("has falls through", func(t *testing.T) {
+		defer c1.reset()
+		defer c2.reset()
+		c2.hasMock = func(s string) (bool, error) { return true, nil }
+		ok, err := chain.has("foo")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("error during has", func(t *testing.T) {
+		defer c1.reset()
+		defer c2.reset()
+		c2.hasMock = func(s string) (bool, error) { return false, testErr }
+		_, err := chain.has("foo")
+		assert.ErrorIs(t, err, testErr)
+	})
+
+	t.Run("stat prefers last kvs", func(t *testing.T) {
+		defer c1.reset()
+		defer c2.reset()
+		c1.statMock = func(s string) (KeyInfo, error) { return KeyInfo{Size: 1}, nil }
+		c2.statMock = func(s string) (KeyInfo, error) { return KeyInfo{Size: 2}, nil }
+		info, err := chain.stat("foo")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), info.Size)
+	})
+
+	t.Run("stat skips missing key", func(t *testing.T) {
+		defer c1.reset()
+		defer c2.reset()
+		c1.statMock = func(s string) (KeyInfo, error) { return KeyInfo{Size: 1}, nil }
+		c2.statMock = func(s string) (KeyInfo, error) { return KeyInfo{}, notfound }
+		info, err := chain.stat("foo")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), info.Size)
+	})
+
+	t.Run("stat missing key", func(t *testing.T) {
+		defer c1.reset()
+		defer c2.reset()
+		c1.statMock = func(s string) (KeyInfo, error) { return KeyInfo{}, notfound }
+		c2.statMock = func(s string) (KeyInfo, error) { return KeyInfo{}, notfound }
+		_, err := chain.stat("foo")
+		assert.ErrorIs(t, err, notfound)
+	})
+
+	t.Run("error during stat", func(t *testing.T) {
+		defer c1.reset()
+		defer c2.reset()
+		c2.statMock = func(s string) (KeyInfo, error) { return KeyInfo{}, testErr }
+		_, err := chain.stat("foo")
+		assert.ErrorIs(t, err, testErr)
+	})
+
+	t.Run("error during update", func(t *testing.T) {
+		defer c1.reset()
+		defer c2.reset()
+		c2.updateMock = func(s string, fn updateFunc) error { return testErr }
+		err := chain.update("foo", nil)
+		assert.ErrorIs(t, err, testErr)
+	})
+
+	t.Run("commit on last kvs first", func(t *testing.T) {
+		defer c1.reset()
+		defer c2.reset()
+		var order []int
+		c1.commitMock = func(ops []op) error {
+			order = append(order, 1)
+			return nil
+		}
+		c2.commitMock = func(ops []op) error {
+			order = append(order, 2)
+			return nil
+		}
+		require.NoError(t, chain.commit([]op{{Key: "foo"}}))
+		assert.Equal(t, []int{2, 1}, order)
+	})
+
+	t.Run("error during commit", func(t *testing.T) {
+		defer c1.reset()
+		defer c2.reset()
+		c2.commitMock = func(ops []op) error { return testErr }
+		c1.commitMock = func(ops []op) error {
+			t.Fail()
+			return nil
+		}
+		var evicted []string
+		c1.deleteMock = func(s string) error {
+			evicted = append(evicted, s)
+			return nil
+		}
+		err := chain.commit([]op{{Key: "foo"}, {Key: "bar", Del: true}})
+		assert.ErrorIs(t, err, testErr)
+		assert.Equal(t, []string{"foo", "bar"}, evicted)
+	})
+
+	t.Run("error during stream", func(t *testing.T) {
+		defer c1.reset()
+		defer c2.reset()
+		c2.storeStreamMock = func(s string, r io.Reader) error { return testErr }
+		assert.ErrorIs(t, chain.storeStream("foo", nil), testErr)
+		c1.loadStreamMock = func(s string) (io.ReadCloser, error) { return nil, testErr }
+		_, err := chain.loadStream("foo")
+		assert.ErrorIs(t, err, testErr)
+	})
+
+	t.Run("expire", func(t *testing.T) {
+		defer c1.reset()
+		defer c2.reset()
+		var order []int
+		c1.expireMock = func(s string, exp time.Time) error {
+			order = append(order, 1)
+			return notfound
+		}
+		c2.expireMock = func(s string, exp time.Time) error {
+			order = append(order, 2)
+			return nil
+		}
+		require.NoError(t, chain.expire("foo", time.Time{}))
+		assert.Equal(t, []int{2, 1}, order)
+	})
+
+	t.Run("expire missing key", func(t *testing.T) {
+		defer c1.reset()
+		defer c2.reset()
+		c2.expireMock = func(s string, exp time.Time) error { return notfound }
+		err := chain.expire("foo", time.Time{})
+		assert.ErrorIs(t, err, notfound)
+	})
+
+	t.Run("error during store with ttl", func(t *testing.T) {
+		defer c1.reset()
+		defer c2.reset()
+		c2.storeTTLMock = func(s string, b []byte, exp time.Time) error { return testErr }
+		assert.ErrorIs(t, chain.storeTTL("foo", nil, time.Time{}), testErr)
+	})
+
+	t.Run("error during reap", func(t *testing.T) {
+		defer c1.reset()
+		defer c2.reset()
+		c2.reapMock = func() error { return testErr }
+		assert.ErrorIs(t, chain.reap(), testErr)
+	})
+
 	t.Run("key missing partially", func(t *testing.T) {
 		defer c1.reset()
 		defer c2.reset()
@@ -113,4 +346,31 @@ func Test_ChainErrors(t *testing.T) {
 		assert.NoError(t, err)
 	})
 
+	t.Run("with context", func(t *testing.T) {
+		defer c1.reset()
+		defer c2.reset()
+		ctx := context.Background()
+		bound := []*testKvs{{}, {}}
+		c1.withMock = func(c context.Context) kvs {
+			assert.Equal(t, ctx, c)
+			return bound[0]
+		}
+		c2.withMock = func(c context.Context) kvs {
+			assert.Equal(t, ctx, c)
+			return bound[1]
+		}
+		stored := 0
+		for _, b := range bound {
+			b.storeMock = func(s string, b []byte) error {
+				stored++
+				return nil
+			}
+		}
+		c1.storeMock = func(s string, b []byte) error { return testErr }
+		c2.storeMock = func(s string, b []byte) error { return testErr }
+		assert.NoError(t, chain.with(ctx).store("foo", nil))
+		assert.Equal(t, 2, stored)
+		assert.Equal(t, []kvs{c1, c2}, chain.list)
+	})
+
 }
@@ -0,0 +1,76 @@
+package picodb
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Codec converts the values of StoreValue and LoadValue
+// to and from bytes.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)      // encode a value
+	Unmarshal(data []byte, v interface{}) error // decode data into the value pointed to by v
+}
+
+// JSONCodec encodes values as JSON.
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// GobCodec encodes values with the gob package.
+// Every value is encoded in a separate stream, so the type
+// information is stored with each value.
+type GobCodec struct{}
+
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// StoreValue encodes a value with the codec of the options,
+// and stores it under the given key.
+// Encoding errors are returned as a CodecError.
+func (p *PicoDb) StoreValue(key string, v interface{}) error {
+	b, err := p.codec().Marshal(v)
+	if err != nil {
+		return NewCodecError(key, err)
+	}
+	return p.Store(key, b)
+}
+
+// LoadValue loads a key, and decodes its value with the codec
+// of the options into the value pointed to by v.
+// If the key is missing, an error is returned.
+// Decoding errors are returned as a CodecError.
+func (p *PicoDb) LoadValue(key string, v interface{}) error {
+	b, err := p.Load(key)
+	if err != nil {
+		return err
+	}
+	if err := p.codec().Unmarshal(b, v); err != nil {
+		return NewCodecError(key, err)
+	}
+	return nil
+}
+
+// codec returns the codec of the options, which defaults to gob.
+func (p *PicoDb) codec() Codec {
+	if p.opt == nil || p.opt.Codec == nil {
+		return GobCodec{}
+	}
+	return p.opt.Codec
+}
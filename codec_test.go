@@ -0,0 +1,69 @@
+package picodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testValue struct {
+	Name  string
+	Count int
+	Tags  []string
+}
+
+func Test_Codec(t *testing.T) {
+
+	for name, codec := range map[string]Codec{
+		"json": JSONCodec{},
+		"gob":  GobCodec{},
+	} {
+		t.Run(name, func(t *testing.T) {
+			pico := New(Defaults().WithRootDir(t.TempDir()).WithCompression().WithCodec(codec))
+			in := testValue{Name: "foo", Count: 42, Tags: []string{"bar", "baz"}}
+			require.NoError(t, pico.StoreValue("foo", in))
+
+			var out testValue
+			require.NoError(t, pico.LoadValue("foo", &out))
+			assert.Equal(t, in, out)
+
+			b, err := pico.Load("foo")
+			require.NoError(t, err)
+			var raw testValue
+			require.NoError(t, codec.Unmarshal(b, &raw))
+			assert.Equal(t, in, raw)
+
+			err = pico.LoadValue("missing", &out)
+			assert.ErrorIs(t, err, NewKeyNotFound("missing"))
+		})
+	}
+
+	t.Run("encoding error", func(t *testing.T) {
+		pico := New(Defaults().WithRootDir(t.TempDir()).WithCodec(JSONCodec{}))
+		err := pico.StoreValue("foo", make(chan int))
+		var ce CodecError
+		assert.True(t, errors.As(err, &ce))
+		has, err := pico.Has("foo")
+		require.NoError(t, err)
+		assert.False(t, has)
+	})
+
+	t.Run("decoding error", func(t *testing.T) {
+		pico := New(Defaults().WithRootDir(t.TempDir()).WithCodec(JSONCodec{}))
+		require.NoError(t, pico.StoreString("foo", "not json"))
+		var out testValue
+		err := pico.LoadValue("foo", &out)
+		var ce CodecError
+		assert.True(t, errors.As(err, &ce))
+	})
+
+	t.Run("default codec", func(t *testing.T) {
+		pico := &PicoDb{}
+		assert.Equal(t, GobCodec{}, pico.codec())
+		pico.opt = Defaults().WithCodec(nil)
+		assert.Equal(t, GobCodec{}, pico.codec())
+	})
+
+}
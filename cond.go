@@ -0,0 +1,55 @@
+package picodb
+
+import "bytes"
+
+// StoreIfAbsent stores the key only if it does not exist yet.
+// Reports whether the key was stored.
+func (p *PicoDb) StoreIfAbsent(key string, val []byte) (bool, error) {
+	return p.storeIf(key, val, func(old []byte, exists bool) bool {
+		return !exists
+	})
+}
+
+// StoreIfPresent stores the key only if it already exists.
+// Reports whether the key was stored.
+func (p *PicoDb) StoreIfPresent(key string, val []byte) (bool, error) {
+	return p.storeIf(key, val, func(old []byte, exists bool) bool {
+		return exists
+	})
+}
+
+// CompareAndSwap stores the new value only if the key exists
+// and its current value equals old.
+// Reports whether the key was stored.
+func (p *PicoDb) CompareAndSwap(key string, old, new []byte) (bool, error) {
+	return p.storeIf(key, new, func(cur []byte, exists bool) bool {
+		return exists && bytes.Equal(cur, old)
+	})
+}
+
+// storeIf stores the key if cond holds for its current value.
+// The check and the store are done atomically under the key's lock.
+func (p *PicoDb) storeIf(key string, val []byte, cond func([]byte, bool) bool) (bool, error) {
+	stored := false
+	err := p.kvs.update(key, func(old []byte, exists bool) ([]byte, error) {
+		if !cond(old, exists) {
+			return nil, errSkip
+		}
+		stored = true
+		return val, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return stored, nil
+}
+
+// Update atomically replaces the value of a key with the result of fn.
+// fn receives the current value and whether the key exists, and
+// returns the new value. Returning ErrDelete deletes the key,
+// returning any other error leaves the key unchanged and the
+// error is returned.
+// The key is locked while it is read, updated and written back.
+func (p *PicoDb) Update(key string, fn func(old []byte, exists bool) ([]byte, error)) error {
+	return p.kvs.update(key, fn)
+}
@@ -0,0 +1,175 @@
+package picodb
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Conditional(t *testing.T) {
+
+	pico := &PicoDb{
+		kvs: &cache{m: &sync.Map{}},
+	}
+
+	t.Run("store if absent", func(t *testing.T) {
+		ok, err := pico.StoreIfAbsent("foo", []byte{1})
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = pico.StoreIfAbsent("foo", []byte{2})
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		val, err := pico.Load("foo")
+		require.NoError(t, err)
+		assert.Equal(t, []byte{1}, val)
+	})
+
+	t.Run("store if present", func(t *testing.T) {
+		ok, err := pico.StoreIfPresent("bar", []byte{1})
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		_, err = pico.Load("bar")
+		assert.ErrorIs(t, err, NewKeyNotFound("bar"))
+
+		require.NoError(t, pico.Store("bar", []byte{1}))
+		ok, err = pico.StoreIfPresent("bar", []byte{2})
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		val, err := pico.Load("bar")
+		require.NoError(t, err)
+		assert.Equal(t, []byte{2}, val)
+	})
+
+	t.Run("compare and swap", func(t *testing.T) {
+		ok, err := pico.CompareAndSwap("baz", nil, []byte{1})
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		require.NoError(t, pico.Store("baz", []byte{1}))
+
+		ok, err = pico.CompareAndSwap("baz", []byte{2}, []byte{3})
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		ok, err = pico.CompareAndSwap("baz", []byte{1}, []byte{3})
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		val, err := pico.Load("baz")
+		require.NoError(t, err)
+		assert.Equal(t, []byte{3}, val)
+	})
+
+	t.Run("update error", func(t *testing.T) {
+		testErr := errors.New("test")
+		pico := &PicoDb{
+			kvs: &testKvs{
+				updateMock: func(s string, fn updateFunc) error {
+					return testErr
+				},
+			},
+		}
+		ok, err := pico.StoreIfAbsent("foo", nil)
+		assert.ErrorIs(t, err, testErr)
+		assert.False(t, ok)
+	})
+
+}
+
+func Test_Update(t *testing.T) {
+
+	pico := &PicoDb{
+		kvs: &cache{m: &sync.Map{}},
+	}
+	testErr := errors.New("test")
+
+	incr := func(old []byte, exists bool) ([]byte, error) {
+		n := 0
+		if exists {
+			n, _ = strconv.Atoi(string(old))
+		}
+		return []byte(strconv.Itoa(n + 1)), nil
+	}
+
+	t.Run("update missing key", func(t *testing.T) {
+		require.NoError(t, pico.Update("counter", incr))
+		val, err := pico.LoadString("counter")
+		require.NoError(t, err)
+		assert.Equal(t, "1", val)
+	})
+
+	t.Run("update existing key", func(t *testing.T) {
+		require.NoError(t, pico.Update("counter", incr))
+		val, err := pico.LoadString("counter")
+		require.NoError(t, err)
+		assert.Equal(t, "2", val)
+	})
+
+	t.Run("delete key", func(t *testing.T) {
+		err := pico.Update("counter", func(old []byte, exists bool) ([]byte, error) {
+			return nil, ErrDelete
+		})
+		require.NoError(t, err)
+		_, err = pico.Load("counter")
+		assert.ErrorIs(t, err, NewKeyNotFound("counter"))
+	})
+
+	t.Run("error leaves key unchanged", func(t *testing.T) {
+		require.NoError(t, pico.StoreString("foo", "bar"))
+		err := pico.Update("foo", func(old []byte, exists bool) ([]byte, error) {
+			return []byte("baz"), testErr
+		})
+		assert.ErrorIs(t, err, testErr)
+		val, err := pico.LoadString("foo")
+		require.NoError(t, err)
+		assert.Equal(t, "bar", val)
+	})
+
+	t.Run("concurrent updates on disk", func(t *testing.T) {
+		pico := New(Defaults().WithRootDir(t.TempDir()).WithCaching())
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, pico.Update("counter", incr))
+			}()
+		}
+		wg.Wait()
+		val, err := pico.LoadString("counter")
+		require.NoError(t, err)
+		assert.Equal(t, "20", val)
+	})
+
+}
+
+func Test_ConditionalConcurrency(t *testing.T) {
+	pico := New(Defaults().WithRootDir(t.TempDir()))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	winners := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ok, err := pico.StoreIfAbsent("job", []byte(strconv.Itoa(i)))
+			assert.NoError(t, err)
+			if ok {
+				mu.Lock()
+				winners++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 1, winners)
+}
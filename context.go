@@ -0,0 +1,93 @@
+package picodb
+
+import (
+	"context"
+	"io"
+)
+
+// StoreContext stores a key, like Store.
+// If the context is done while waiting for the lock of the key,
+// the key is not stored and the error of the context is returned.
+func (p *PicoDb) StoreContext(ctx context.Context, key string, val []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.kvs.with(ctx).store(key, val)
+}
+
+// LoadContext loads a key, like Load.
+// If the context is already done, the error of the context is returned.
+func (p *PicoDb) LoadContext(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return p.kvs.with(ctx).load(key)
+}
+
+// DeleteContext deletes a key, like Delete.
+// If the context is already done, the error of the context is returned.
+func (p *PicoDb) DeleteContext(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.kvs.with(ctx).delete(key)
+}
+
+// UpdateContext updates a key, like Update.
+// If the context is done while waiting for the lock of the key,
+// fn is not called and the error of the context is returned.
+func (p *PicoDb) UpdateContext(ctx context.Context, key string, fn func(old []byte, exists bool) ([]byte, error)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.kvs.with(ctx).update(key, fn)
+}
+
+// StoreReaderContext stores a key with the contents of the reader,
+// like StoreReader.
+// If the context is done before the reader is drained, the key is
+// not stored and the error of the context is returned.
+func (p *PicoDb) StoreReaderContext(ctx context.Context, key string, r io.Reader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.kvs.with(ctx).storeStream(key, &ctxReader{ctx: ctx, r: r})
+}
+
+// LoadReaderContext opens a key for reading, like LoadReader.
+// Once the context is done, reading from the returned reader
+// fails with the error of the context.
+// The caller must close the returned reader.
+func (p *PicoDb) LoadReaderContext(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rc, err := p.kvs.with(ctx).loadStream(key)
+	if err != nil {
+		return nil, err
+	}
+	return &ctxReadCloser{ctxReader: ctxReader{ctx: ctx, r: rc}, c: rc}, nil
+}
+
+// ctxReader is a reader which fails once its context is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// ctxReadCloser is a ctxReader which can be closed.
+type ctxReadCloser struct {
+	ctxReader
+	c io.Closer
+}
+
+func (r *ctxReadCloser) Close() error {
+	return r.c.Close()
+}
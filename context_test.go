@@ -0,0 +1,201 @@
+package picodb
+
+import (
+	"context"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Context(t *testing.T) {
+
+	for name, opt := range map[string]*PicoDbOptions{
+		"default":     Defaults(),
+		"compression": Defaults().WithCompression(),
+		"caching":     Defaults().WithCaching().WithLocking(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			pico := New(opt.WithRootDir(t.TempDir()))
+			ctx := context.Background()
+
+			require.NoError(t, pico.StoreContext(ctx, "foo", []byte("bar")))
+			val, err := pico.LoadContext(ctx, "foo")
+			require.NoError(t, err)
+			assert.Equal(t, []byte("bar"), val)
+
+			err = pico.UpdateContext(ctx, "foo", func(old []byte, exists bool) ([]byte, error) {
+				return append(old, '!'), nil
+			})
+			require.NoError(t, err)
+
+			require.NoError(t, pico.StoreReaderContext(ctx, "baz", strings.NewReader("qux")))
+			rc, err := pico.LoadReaderContext(ctx, "baz")
+			require.NoError(t, err)
+			b, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+			assert.Equal(t, "qux", string(b))
+
+			vals, err := pico.LoadManyContext(ctx, []string{"foo", "baz"})
+			require.NoError(t, err)
+			assert.Equal(t, map[string][]byte{"foo": []byte("bar!"), "baz": []byte("qux")}, vals)
+
+			require.NoError(t, pico.DeleteContext(ctx, "foo"))
+			_, err = pico.LoadContext(ctx, "foo")
+			assert.ErrorIs(t, err, NewKeyNotFound("foo"))
+		})
+	}
+
+	t.Run("done context", func(t *testing.T) {
+		pico := New(Defaults().WithRootDir(t.TempDir()))
+		require.NoError(t, pico.StoreString("foo", "bar"))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		assert.ErrorIs(t, pico.StoreContext(ctx, "baz", nil), context.Canceled)
+		assert.ErrorIs(t, pico.DeleteContext(ctx, "foo"), context.Canceled)
+		assert.ErrorIs(t, pico.UpdateContext(ctx, "foo", nil), context.Canceled)
+		assert.ErrorIs(t, pico.StoreReaderContext(ctx, "baz", strings.NewReader("")), context.Canceled)
+		assert.ErrorIs(t, pico.StoreManyContext(ctx, map[string][]byte{"baz": nil}), context.Canceled)
+		assert.ErrorIs(t, pico.DeleteManyContext(ctx, []string{"foo"}), context.Canceled)
+		_, err := pico.LoadContext(ctx, "foo")
+		assert.ErrorIs(t, err, context.Canceled)
+		_, err = pico.LoadReaderContext(ctx, "foo")
+		assert.ErrorIs(t, err, context.Canceled)
+		_, err = pico.LoadManyContext(ctx, []string{"foo"})
+		assert.ErrorIs(t, err, context.Canceled)
+		err = pico.TxnContext(ctx, func(tx *Tx) error {
+			tx.StoreString("baz", "qux")
+			return nil
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+
+		s, err := pico.LoadString("foo")
+		require.NoError(t, err)
+		assert.Equal(t, "bar", s)
+		has, err := pico.Has("baz")
+		require.NoError(t, err)
+		assert.False(t, has)
+	})
+
+	t.Run("waiting for a lock", func(t *testing.T) {
+		dir := t.TempDir()
+		pico := New(Defaults().WithRootDir(dir).WithLocking())
+		require.NoError(t, pico.StoreString("foo", "bar"))
+
+		l := flock.New(path.Join(dir, lockPrefix+"foo"))
+		require.NoError(t, l.Lock())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := pico.StoreContext(ctx, "foo", []byte("baz"))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		err = pico.UpdateContext(ctx, "foo", func(old []byte, exists bool) ([]byte, error) {
+			t.Fatal("updated without the lock")
+			return nil, nil
+		})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		require.NoError(t, l.Unlock())
+		ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		require.NoError(t, pico.StoreContext(ctx, "foo", []byte("baz")))
+		s, err := pico.LoadString("foo")
+		require.NoError(t, err)
+		assert.Equal(t, "baz", s)
+	})
+
+	t.Run("transaction is applied once committed", func(t *testing.T) {
+		dir := t.TempDir()
+		pico := New(Defaults().WithRootDir(dir).WithLocking())
+		require.NoError(t, pico.StoreString("b", "0"))
+
+		l := flock.New(path.Join(dir, lockPrefix+"b"))
+		require.NoError(t, l.Lock())
+		time.AfterFunc(200*time.Millisecond, func() { l.Unlock() })
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := pico.TxnContext(ctx, func(tx *Tx) error {
+			tx.StoreString("a", "1")
+			tx.StoreString("b", "2")
+			return nil
+		})
+		require.NoError(t, err)
+		vals, err := pico.LoadMany([]string{"a", "b"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]byte{"a": []byte("1"), "b": []byte("2")}, vals)
+		assert.NoFileExists(t, path.Join(dir, journal))
+	})
+
+	t.Run("cancel while streaming", func(t *testing.T) {
+		for name, opt := range map[string]*PicoDbOptions{
+			"default":     Defaults(),
+			"compression": Defaults().WithCompression(),
+		} {
+			t.Run(name, func(t *testing.T) {
+				pico := New(opt.WithRootDir(t.TempDir()))
+				ctx, cancel := context.WithCancel(context.Background())
+				r := &cancelReader{r: strings.NewReader(strings.Repeat("x", 1<<20)), cancel: cancel}
+				err := pico.StoreReaderContext(ctx, "foo", r)
+				assert.ErrorIs(t, err, context.Canceled)
+				has, err := pico.Has("foo")
+				require.NoError(t, err)
+				assert.False(t, has)
+
+				require.NoError(t, pico.StoreString("foo", strings.Repeat("x", 1<<20)))
+				ctx, cancel = context.WithCancel(context.Background())
+				rc, err := pico.LoadReaderContext(ctx, "foo")
+				require.NoError(t, err)
+				defer rc.Close()
+				_, err = rc.Read(make([]byte, 16))
+				require.NoError(t, err)
+				cancel()
+				_, err = io.ReadAll(rc)
+				assert.ErrorIs(t, err, context.Canceled)
+			})
+		}
+	})
+
+	t.Run("cancel batch", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		var calls int32
+		pico := &PicoDb{
+			opt: Defaults().WithWorkers(1),
+			kvs: &testKvs{
+				storeMock: func(s string, b []byte) error {
+					atomic.AddInt32(&calls, 1)
+					cancel()
+					return nil
+				},
+			},
+		}
+		vals := make(map[string][]byte)
+		for i := 0; i < 100; i++ {
+			vals[strconv.Itoa(i)] = nil
+		}
+		err := pico.StoreManyContext(ctx, vals)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Less(t, atomic.LoadInt32(&calls), int32(100))
+	})
+
+}
+
+// cancelReader cancels its context after the first read.
+type cancelReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+}
+
+func (r *cancelReader) Read(p []byte) (int, error) {
+	defer r.cancel()
+	return r.r.Read(p)
+}
@@ -1,16 +1,34 @@
 package picodb
 
 import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
 	"os"
 	"path"
+	"strconv"
 	"strings"
+	"time"
 )
 
-// dirfs uses a single directory with a flat structure to map names to files.
+// lockRetry is the delay between attempts to acquire a lock
+// while waiting for a context.
+const lockRetry = 10 * time.Millisecond
+
+// dirfs uses a single directory to map names to files, either with
+// a flat structure, or with the files nested in shard directories.
 type dirfs struct {
-	root    string  // the root directory which hosts the files
-	locking bool    // use locking for file access
-	s       storage // underlying storage
+	root    string          // the root directory which hosts the files
+	locking bool            // use locking for file access
+	enc     KeyEncoding     // maps keys to file names
+	depth   int             // number of nested shard directories, zero for a flat structure
+	width   int             // number of hex digits in the name of a shard directory
+	s       storage         // underlying storage
+	ctx     context.Context // cancels waiting for locks, nil if not bound
 }
 
 // store a key-value pair.
@@ -19,43 +37,105 @@ type dirfs struct {
 // A KeyInvalid error is returned if the given key
 // cannot be used as a file name.
 func (d *dirfs) store(key string, val []byte) error {
+	return d.storeTTL(key, val, time.Time{})
+}
+
+// storeTTL stores a key-value pair which expires at the given time.
+// A zero expiry time means the key never expires.
+// The expiry is written before the value, so a crash in between
+// never leaves a value without its expiry.
+// A KeyInvalid error is returned if the given key
+// cannot be used as a file name.
+func (d *dirfs) storeTTL(key string, val []byte, exp time.Time) error {
 	if err := d.check(key); err != nil {
 		return err
 	}
-	if err := d.mkroot(); err != nil {
+	if err := d.mkparent(key); err != nil {
 		return err
 	}
 	path := d.path(key)
-	if d.locking {
-		lock := d.s.getl(path)
-		if err := lock.Lock(); err != nil {
+	unlock, err := d.lockw(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if !exp.IsZero() {
+		if err := d.setExpiry(key, exp); err != nil {
 			return err
 		}
-		defer lock.Unlock()
 	}
-	return d.s.write(path, val)
+	if err := d.s.write(path, val); err != nil {
+		return err
+	}
+	if exp.IsZero() {
+		return d.clearExpiry(key)
+	}
+	return nil
+}
+
+// storeStream stores the contents of the reader under the given key.
+// Apart from the source of the value, it works the same way as store.
+func (d *dirfs) storeStream(key string, r io.Reader) error {
+	if err := d.check(key); err != nil {
+		return err
+	}
+	if err := d.mkparent(key); err != nil {
+		return err
+	}
+	path := d.path(key)
+	unlock, err := d.lockw(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := d.s.writeStream(path, r); err != nil {
+		return err
+	}
+	return d.clearExpiry(key)
 }
 
 // load the value associated with the given key.
 // Data is loaded from a file with the name of the given key.
-// A KeyNotFound error is returned if the key does not exist.
+// A KeyNotFound error is returned if the key does not exist,
+// or it has expired.
 // A KeyInvalid error is returned if the given key
-// cannot be used as a file name.
+// cannot be used as a file name, or its file is not
+// a regular file.
 func (d *dirfs) load(key string) ([]byte, error) {
 	if err := d.check(key); err != nil {
 		return nil, err
 	}
+	if err := d.alive(key); err != nil {
+		return nil, err
+	}
 	path := d.path(key)
 	b, err := d.s.read(path)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, NewKeyNotFound(key)
-		}
-		return nil, err
+		return nil, d.readErr(key, err)
 	}
 	return b, nil
 }
 
+// loadStream opens the value associated with the given key for reading.
+// A KeyNotFound error is returned if the key does not exist,
+// or it has expired.
+// A KeyInvalid error is returned if the given key
+// cannot be used as a file name, or its file is not
+// a regular file.
+func (d *dirfs) loadStream(key string) (io.ReadCloser, error) {
+	if err := d.check(key); err != nil {
+		return nil, err
+	}
+	if err := d.alive(key); err != nil {
+		return nil, err
+	}
+	rc, err := d.s.readStream(d.path(key))
+	if err != nil {
+		return nil, d.readErr(key, err)
+	}
+	return rc, nil
+}
+
 // delete a key and the associated value.
 // A KeyInvalid error is returned if the given key
 // If the key does not exist, nothing is deleted and
@@ -65,6 +145,20 @@ func (d *dirfs) delete(key string) error {
 		return err
 	}
 	path := d.path(key)
+	unlock, err := d.lockDelete(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := d.remove(path); err != nil {
+		return err
+	}
+	return d.clearExpiry(key)
+}
+
+// remove deletes the file with the given path.
+// A missing file is not an error.
+func (d *dirfs) remove(path string) error {
 	err := d.s.remove(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -75,21 +169,729 @@ func (d *dirfs) delete(key string) error {
 	return nil
 }
 
-// check if the name is valid.
+// keys returns the keys stored under the root directory.
+// Expired keys are not listed, neither are the files whose name
+// is not the encoding of a key.
+// A missing root directory is treated as an empty store.
+func (d *dirfs) keys() ([]string, error) {
+	base := d.root
+	if d.depth > 0 {
+		base = path.Join(d.root, shardDir)
+	}
+	names, err := d.walk(base, d.depth)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	expiring, err := d.expiring()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		key, err := d.enc.decode(name)
+		if err != nil {
+			continue
+		}
+		if expiring[key] {
+			if err := d.alive(key); err != nil {
+				if errors.Is(err, NewKeyNotFound(key)) {
+					continue
+				}
+				return nil, err
+			}
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// walk returns the names of the files in the given directory,
+// descending into its subdirectories depth levels deep.
+// Shard directories removed while walking are skipped.
+func (d *dirfs) walk(dir string, depth int) ([]string, error) {
+	if depth == 0 {
+		return d.s.list(dir)
+	}
+	subs, err := d.s.dirs(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, sub := range subs {
+		n, err := d.walk(path.Join(dir, sub), depth-1)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		names = append(names, n...)
+	}
+	return names, nil
+}
+
+// update the value of a key with the result of fn.
+// The key is locked while it is read, updated and written back,
+// regardless of the locking setting. If fn returns ErrDelete,
+// the key is deleted instead.
+// The expiry of an existing key is kept, an expired key is
+// treated as missing.
+// A KeyInvalid error is returned if the given key
+// cannot be used as a file name.
+func (d *dirfs) update(key string, fn updateFunc) error {
+	if err := d.check(key); err != nil {
+		return err
+	}
+	if err := d.mkparent(key); err != nil {
+		return err
+	}
+	path := d.path(key)
+	unlock, err := d.lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	exists := true
+	if err := d.alive(key); err != nil {
+		if !errors.Is(err, NewKeyNotFound(key)) {
+			return err
+		}
+		exists = false
+	}
+	var old []byte
+	if exists {
+		old, err = d.s.read(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return d.readErr(key, err)
+			}
+			exists = false
+		}
+	}
+	val, err := fn(old, exists)
+	if err != nil {
+		if errors.Is(err, errSkip) {
+			return nil
+		}
+		if errors.Is(err, ErrDelete) {
+			if err := d.remove(path); err != nil {
+				return err
+			}
+			if err := d.clearExpiry(key); err != nil {
+				return err
+			}
+			d.dropLock(path)
+			return nil
+		}
+		return err
+	}
+	if err := d.s.write(path, val); err != nil {
+		return err
+	}
+	if !exists {
+		return d.clearExpiry(key)
+	}
+	return nil
+}
+
+// expire sets the expiry time of an existing key.
+// A zero expiry time means the key never expires.
+// A KeyNotFound error is returned if the key does not exist,
+// or it has already expired.
+// A KeyInvalid error is returned if the given key
+// cannot be used as a file name.
+func (d *dirfs) expire(key string, exp time.Time) error {
+	if err := d.check(key); err != nil {
+		return err
+	}
+	if err := d.mkparent(key); err != nil {
+		return err
+	}
+	unlock, err := d.lockw(d.path(key))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if _, err := d.stat(key); err != nil {
+		return err
+	}
+	if exp.IsZero() {
+		return d.clearExpiry(key)
+	}
+	return d.setExpiry(key, exp)
+}
+
+// reap deletes the expired keys.
+func (d *dirfs) reap() error {
+	expiring, err := d.expiring()
+	if err != nil {
+		return err
+	}
+	for key := range expiring {
+		if err := d.reapKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reapKey deletes the given key if it has expired.
+func (d *dirfs) reapKey(key string) error {
+	if err := d.check(key); err != nil {
+		return err
+	}
+	path := d.path(key)
+	unlock, err := d.lockDelete(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := d.alive(key); !errors.Is(err, NewKeyNotFound(key)) {
+		return err // not expired, or an actual error
+	}
+	if err := d.remove(path); err != nil {
+		return err
+	}
+	return d.clearExpiry(key)
+}
+
+// commit applies the changes atomically.
+// The changes are first written to a journal file in the root
+// directory, then applied one by one, and finally the journal is
+// removed. The journal is flushed to disk before the changes are
+// applied, whatever the sync mode. If the process crashes in
+// between, the journal is replayed by recover. If applying the changes fails, the journal
+// is kept, and replayed by the next commit before its own changes.
+// Concurrent commits are serialized with a lock on the journal.
+// A context bound to the dirfs only stops waiting for the lock of
+// the journal, not for the locks of the keys while applying them.
+// A KeyInvalid error is returned if any of the keys
+// cannot be used as a file name, and nothing is changed.
+func (d *dirfs) commit(ops []op) error {
+	for _, o := range ops {
+		if err := d.check(o.Key); err != nil {
+			return err
+		}
+	}
+	if err := d.mkroot(); err != nil {
+		return err
+	}
+	path := path.Join(d.root, journal)
+	unlock, err := d.lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := d.replayPending(path); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(ops); err != nil {
+		return err
+	}
+	if err := d.s.write(path, buf.Bytes()); err != nil {
+		return err
+	}
+	// whatever the sync mode, the journal must be on disk before
+	// any change is, so that a torn journal means nothing is applied
+	if err := d.durable(path); err != nil {
+		d.remove(path)
+		return err
+	}
+	// once journaled, the changes are applied regardless of the context
+	unbound := *d
+	unbound.ctx = nil
+	return unbound.replay(path, ops)
+}
+
+// durable flushes the file with the given path and the root
+// directory to disk.
+func (d *dirfs) durable(path string) error {
+	if err := d.s.flush(path); err != nil {
+		return err
+	}
+	return d.s.flush(d.root)
+}
+
+// recover replays the journal left behind by an interrupted commit.
+// A missing journal or root directory is not an error.
+func (d *dirfs) recover() error {
+	path := path.Join(d.root, journal)
+	// avoid locking, and creating a lock file, without a journal
+	if _, err := d.s.raw().stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	unlock, err := d.lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	// the journal may have been replayed while waiting for the lock
+	return d.replayPending(path)
+}
+
+// replayPending replays the journal with the given path, if there
+// is one. The caller must hold the lock of the journal.
+// A journal which cannot be decoded was torn before it reached the
+// disk, so none of its changes were applied, and it is removed.
+func (d *dirfs) replayPending(path string) error {
+	b, err := d.s.read(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		return err
+	}
+	var ops []op
+	if err == nil {
+		err = gob.NewDecoder(bytes.NewReader(b)).Decode(&ops)
+	}
+	if err != nil {
+		return d.remove(path) // torn, or not compressed as expected
+	}
+	return d.replay(path, ops)
+}
+
+// replay applies the changes of the journal with the given path,
+// and removes the journal once all of them are applied.
+func (d *dirfs) replay(path string, ops []op) error {
+	for _, o := range ops {
+		if err := d.apply(o); err != nil {
+			return err
+		}
+	}
+	return d.remove(path)
+}
+
+// apply a single change to the store.
+func (d *dirfs) apply(o op) error {
+	if err := d.check(o.Key); err != nil {
+		return err
+	}
+	if err := d.mkparent(o.Key); err != nil {
+		return err
+	}
+	path := d.path(o.Key)
+	lock := d.lockw
+	if o.Del {
+		lock = d.lockDelete
+	}
+	unlock, err := lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if o.Del {
+		err = d.remove(path)
+	} else {
+		err = d.s.write(path, o.Val)
+	}
+	if err != nil {
+		return err
+	}
+	return d.clearExpiry(o.Key)
+}
+
+// has reports whether the given key exists.
+// A KeyInvalid error is returned if the given key
+// cannot be used as a file name.
+func (d *dirfs) has(key string) (bool, error) {
+	_, err := d.stat(key)
+	if err != nil {
+		if errors.Is(err, NewKeyNotFound(key)) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// stat returns information about the given key.
+// A KeyNotFound error is returned if the key does not exist,
+// or it has expired.
+// A KeyInvalid error is returned if the given key
+// cannot be used as a file name, or its file is not
+// a regular file.
+func (d *dirfs) stat(key string) (KeyInfo, error) {
+	if err := d.check(key); err != nil {
+		return KeyInfo{}, err
+	}
+	exp, err := d.expiry(key)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	if expired(exp) {
+		return KeyInfo{}, NewKeyNotFound(key)
+	}
+	info, err := d.s.stat(d.path(key))
+	if err != nil {
+		return KeyInfo{}, d.readErr(key, err)
+	}
+	info.Key = key
+	info.Expires = exp
+	return info, nil
+}
+
+// readErr maps an error of reading the file of the given key
+// to the error reported for the key.
+func (d *dirfs) readErr(key string, err error) error {
+	switch {
+	case os.IsNotExist(err):
+		return NewKeyNotFound(key)
+	case errors.Is(err, errNotRegular):
+		return newKeyInvalid(key, ReasonNotRegular)
+	}
+	return err
+}
+
+// alive returns a KeyNotFound error if the given key has expired.
+func (d *dirfs) alive(key string) error {
+	exp, err := d.expiry(key)
+	if err != nil {
+		return err
+	}
+	if expired(exp) {
+		return NewKeyNotFound(key)
+	}
+	return nil
+}
+
+// expiry returns the expiry time of the given key.
+// The expiry time of a key is stored in a file with the name of
+// the key in the ttl directory. A zero time is returned for keys
+// which never expire.
+func (d *dirfs) expiry(key string) (time.Time, error) {
+	b, err := d.s.read(d.tpath(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	ns, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, ns), nil
+}
+
+// setExpiry stores the expiry time of the given key.
+func (d *dirfs) setExpiry(key string, exp time.Time) error {
+	tpath := d.tpath(key)
+	if err := d.s.mkdir(path.Dir(tpath)); err != nil {
+		return err
+	}
+	return d.s.write(tpath, []byte(strconv.FormatInt(exp.UnixNano(), 10)))
+}
+
+// clearExpiry removes the expiry time of the given key.
+func (d *dirfs) clearExpiry(key string) error {
+	return d.remove(d.tpath(key))
+}
+
+// expiring returns the set of keys with an expiry time.
+func (d *dirfs) expiring() (map[string]bool, error) {
+	names, err := d.walk(path.Join(d.root, ttlDir), d.depth)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	keys := make(map[string]bool, len(names))
+	for _, name := range names {
+		if key, err := d.enc.decode(name); err == nil {
+			keys[key] = true
+		}
+	}
+	return keys, nil
+}
+
+// buckets returns the names of the buckets, which are the
+// subdirectories of the root directory.
+// A missing root directory is treated as an empty store.
+func (d *dirfs) buckets() ([]string, error) {
+	names, err := d.s.dirs(d.root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	return names, nil
+}
+
+// dropBucket deletes the given bucket with all of its keys.
+// A missing bucket is not an error.
+// A KeyInvalid error is returned if the given name
+// cannot be used as a directory name.
+func (d *dirfs) dropBucket(name string) error {
+	if err := d.checkBucket(name); err != nil {
+		return err
+	}
+	return d.s.removeAll(path.Join(d.root, name))
+}
+
+// snapshot creates a snapshot of the keys in the given directory,
+// and returns a flat dirfs of it. The files of the keys and their
+// expiry times are hard linked into the snapshot, so later writes,
+// which replace the files, do not change it. The journal is locked
+// meanwhile, so the snapshot has either all or none of the changes
+// of a commit. The directory must be removed by the caller, it is
+// cleaned up as a temporary file otherwise.
+func (d *dirfs) snapshot(dir string) (*dirfs, error) {
+	snap := &dirfs{root: dir, enc: d.enc, s: d.s}
+	unlock, err := d.lock(path.Join(d.root, journal))
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	keys, err := d.keys()
+	if err != nil {
+		return nil, err
+	}
+	if err := d.s.mkdir(path.Join(dir, ttlDir)); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		// keys deleted since they were listed are left out
+		if err := d.s.link(d.tpath(key), snap.tpath(key)); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err := d.s.link(d.path(key), snap.path(key)); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return snap, nil
+}
+
+// open cleans up after an unclean shutdown.
+// Leftover temporary files are removed, and an interrupted
+// commit is finished.
+func (d *dirfs) open() error {
+	if err := d.clean(); err != nil {
+		return err
+	}
+	return d.recover()
+}
+
+// with returns a copy of the dirfs bound to the given context.
+func (d *dirfs) with(ctx context.Context) kvs {
+	c := *d
+	c.ctx = ctx
+	return &c
+}
+
+// prepare creates the root directory, and makes sure that
+// files can be created in it.
+func (d *dirfs) prepare() error {
+	if err := d.mkroot(); err != nil {
+		return err
+	}
+	probe := path.Join(d.root, reserved+"-probe")
+	if err := d.s.write(probe, nil); err != nil {
+		return err
+	}
+	return d.remove(probe)
+}
+
+// exists returns an error if the root directory cannot be listed,
+// such as when it does not exist.
+func (d *dirfs) exists() error {
+	_, err := d.s.list(d.root)
+	return err
+}
+
+// clean removes leftovers of interrupted writes from the root directory,
+// and from the directory of expiry times, where the expiry times of the
+// flat layout are written. Missing directories are not an error.
+func (d *dirfs) clean() error {
+	for _, dir := range []string{d.root, path.Join(d.root, ttlDir)} {
+		err := d.s.clean(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// check if the name is valid, and its files are within the root
+// directory, see within. Every method reading or writing the files
+// of a key checks it first.
+// Names which are too long to be used as a file name are rejected,
+// and without a key encoding the rules of checkName apply.
 // returns an error if invalid, or nil
 func (d *dirfs) check(name string) error {
-	if strings.ContainsRune(name, os.PathSeparator) {
-		return NewKeyInvalid(name)
+	if len(d.enc.encode(name)) > maxName {
+		return newKeyInvalid(name, ReasonTooLong)
+	}
+	if d.enc == KeyEncodingNone {
+		if err := checkName(name); err != nil {
+			return err
+		}
+	}
+	return d.within(name)
+}
+
+// checkName checks if the name can be used as a file name as is.
+// Names which would not refer to a file directly in the root
+// directory are rejected: the empty name, dot names and names with
+// separators. Names with the prefix of internal files are reserved.
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return newKeyInvalid(name, ReasonDotName)
+	}
+	if strings.ContainsRune(name, '/') || strings.ContainsRune(name, os.PathSeparator) {
+		return newKeyInvalid(name, ReasonSeparator)
+	}
+	if internal(name) {
+		return newKeyInvalid(name, ReasonReserved)
 	}
 	return nil
 }
 
+// checkBucket checks if the name is a valid bucket name.
+// Bucket names are not encoded, so the rules of keys without
+// an encoding apply.
+func (d *dirfs) checkBucket(name string) error {
+	if len(name) > maxName {
+		return newKeyInvalid(name, ReasonTooLong)
+	}
+	return checkName(name)
+}
+
+// lock acquires the lock of the given path, and returns
+// a function which releases it.
+// If the dirfs is bound to a context which can be cancelled,
+// waiting for the lock stops when the context is done, and
+// the error of the context is returned.
+func (d *dirfs) lock(path string) (func(), error) {
+	l := d.s.getl(path)
+	if d.ctx == nil || d.ctx.Done() == nil {
+		if err := l.Lock(); err != nil {
+			return nil, err
+		}
+	} else {
+		ok, err := l.TryLockContext(d.ctx, lockRetry)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, d.ctx.Err()
+		}
+	}
+	return func() { l.Unlock() }, nil
+}
+
+// lockw acquires the lock of the given path for a plain write,
+// which only needs the lock if locking is enabled.
+func (d *dirfs) lockw(path string) (func(), error) {
+	if !d.locking {
+		return func() {}, nil
+	}
+	return d.lock(path)
+}
+
+// within checks that the directories between the root directory
+// and the files of the given key, such as the ttl and the shard
+// directories, are not symbolic links or other files, so that the
+// files of the key are never read or written outside of the root
+// directory. Missing directories are created later by mkparent and
+// setExpiry. It is called by check.
+func (d *dirfs) within(key string) error {
+	root := path.Clean(d.root)
+	for _, name := range []string{d.path(key), d.tpath(key)} {
+		for dir := path.Dir(name); len(dir) > len(root); dir = path.Dir(dir) {
+			if err := d.s.checkDir(dir); err != nil {
+				return d.readErr(key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// lockDelete acquires the lock of the given path for deleting its
+// key, and returns a function which releases it. The lock is needed
+// if locking is enabled, or if the key has a lock file left behind
+// by an update, which is removed together with the key.
+func (d *dirfs) lockDelete(path string) (func(), error) {
+	if !removableLocks {
+		return d.lockw(path)
+	}
+	if !d.locking {
+		if _, err := d.s.raw().stat(d.s.lockName(path)); err != nil {
+			return func() {}, nil
+		}
+	}
+	unlock, err := d.lock(path)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		d.dropLock(path)
+		unlock()
+	}, nil
+}
+
+// dropLock removes the lock file of the given path, which the caller
+// holds, so that lock files do not pile up with deleted keys. Lockers
+// waiting for the removed lock file notice it, and lock a new one.
+// Where that cannot be noticed, the lock file is kept.
+func (d *dirfs) dropLock(path string) {
+	if removableLocks {
+		d.remove(d.s.lockName(path))
+	}
+}
+
 // mkroot creates the dirfs root directory.
 func (d *dirfs) mkroot() error {
 	return d.s.mkdir(d.root)
 }
 
-// path returns the file path associated with the given name.
-func (d *dirfs) path(name string) string {
-	return path.Join(d.root, name)
+// mkparent creates the directory of the file of the given key.
+// Shard directories are created when the first key is stored in them.
+func (d *dirfs) mkparent(key string) error {
+	if d.depth == 0 {
+		return d.mkroot()
+	}
+	return d.s.mkdir(path.Dir(d.path(key)))
+}
+
+// path returns the file path associated with the given key.
+// With sharding, the file is nested in the shard directories
+// of the key under the shard directory of the root.
+func (d *dirfs) path(key string) string {
+	name := d.enc.encode(key)
+	if d.depth == 0 {
+		return path.Join(d.root, name)
+	}
+	return path.Join(d.root, shardDir, d.shard(name), name)
+}
+
+// shard returns the relative path of the shard directories of the
+// given file name, made of the leading hex digits of its hash.
+func (d *dirfs) shard(name string) string {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	sum := fmt.Sprintf("%016x", h.Sum64())
+	dirs := make([]string, d.depth)
+	for i := range dirs {
+		dirs[i] = sum[i*d.width : (i+1)*d.width]
+	}
+	return path.Join(dirs...)
+}
+
+// tpath returns the path of the file holding the expiry time
+// of the given key. With sharding, the file is nested in the same
+// shard directories as the file of the key, under the ttl directory.
+func (d *dirfs) tpath(key string) string {
+	name := d.enc.encode(key)
+	if d.depth == 0 {
+		return path.Join(d.root, ttlDir, name)
+	}
+	return path.Join(d.root, ttlDir, d.shard(name), name)
 }
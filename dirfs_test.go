@@ -1,10 +1,16 @@
 package picodb
 
 import (
+	"bytes"
+	"context"
+	"encoding/gob"
 	"errors"
+	"io"
 	"os"
 	"path"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -39,7 +45,7 @@ func Test_DirFs(t *testing.T) {
 					if s == "root/foo" {
 						return []byte{1}, nil
 					}
-					return nil, nil
+					return nil, os.ErrNotExist
 				},
 			}
 			b, err := dfs.load("foo")
@@ -57,6 +63,19 @@ func Test_DirFs(t *testing.T) {
 			assert.Error(t, err)
 		})
 
+		t.Run("read irregular file", func(t *testing.T) {
+			dfs.s = &testFs{
+				readResult: func(s string) ([]byte, error) {
+					if s == "root/foo" {
+						return nil, &os.PathError{Op: "open", Path: s, Err: errNotRegular}
+					}
+					return nil, os.ErrNotExist
+				},
+			}
+			_, err := dfs.load("foo")
+			assert.ErrorIs(t, err, newKeyInvalid("foo", ReasonNotRegular))
+		})
+
 	})
 
 	t.Run("write", func(t *testing.T) {
@@ -67,6 +86,26 @@ func Test_DirFs(t *testing.T) {
 			assert.ErrorIs(t, err, NewKeyInvalid(key))
 		})
 
+		t.Run("write to reserved key", func(t *testing.T) {
+			key := reserved + "-foo"
+			err := dfs.store(key, []byte{})
+			assert.ErrorIs(t, err, newKeyInvalid(key, ReasonReserved))
+		})
+
+		t.Run("write to dot key", func(t *testing.T) {
+			for _, key := range []string{"", ".", ".."} {
+				err := dfs.store(key, []byte{})
+				assert.ErrorIs(t, err, newKeyInvalid(key, ReasonDotName))
+			}
+		})
+
+		t.Run("write to key with separator", func(t *testing.T) {
+			for _, key := range []string{"../foo", "foo/..", "/foo"} {
+				err := dfs.store(key, []byte{})
+				assert.ErrorIs(t, err, newKeyInvalid(key, ReasonSeparator))
+			}
+		})
+
 		t.Run("root directory is created", func(t *testing.T) {
 			dfs.s = &testFs{
 				mkdirVerify: func(s string) {
@@ -124,12 +163,37 @@ func Test_DirFs(t *testing.T) {
 		})
 
 		t.Run("delete existing key", func(t *testing.T) {
+			var removed []string
 			dfs.s = &testFs{
 				removeVerify: func(s string) {
-					assert.Equal(t, "root/foo", s)
+					removed = append(removed, s)
+				},
+			}
+			assert.NoError(t, dfs.delete("foo"))
+			assert.Equal(t, []string{"root/foo", "root/" + ttlDir + "/foo"}, removed)
+		})
+
+		t.Run("delete removes the lock file", func(t *testing.T) {
+			var removed []string
+			locked := false
+			l := &testLock{
+				lockResult:   func() error { locked = true; return nil },
+				unlockResult: func() error { locked = false; return nil },
+			}
+			dfs.s = &testFs{
+				getlResult: func(s string) lock { return l },
+				statResult: func(s string) (KeyInfo, error) { return KeyInfo{}, nil },
+				removeVerify: func(s string) {
+					if s == "root/foo.lock" {
+						assert.True(t, locked, "removed while unlocked")
+					}
+					removed = append(removed, s)
 				},
 			}
 			assert.NoError(t, dfs.delete("foo"))
+			if removableLocks {
+				assert.Equal(t, []string{"root/foo", "root/" + ttlDir + "/foo", "root/foo.lock"}, removed)
+			}
 		})
 
 		t.Run("delete error", func(t *testing.T) {
@@ -142,6 +206,577 @@ func Test_DirFs(t *testing.T) {
 		})
 
 	})
+
+	t.Run("keys", func(t *testing.T) {
+
+		t.Run("list root directory", func(t *testing.T) {
+			dfs.s = &testFs{
+				listResult: func(s string) ([]string, error) {
+					if s != "root" {
+						return nil, os.ErrNotExist
+					}
+					return []string{"foo", "bar"}, nil
+				},
+			}
+			keys, err := dfs.keys()
+			require.NoError(t, err)
+			assert.Equal(t, []string{"foo", "bar"}, keys)
+		})
+
+		t.Run("missing root directory", func(t *testing.T) {
+			dfs.s = &testFs{
+				listResult: func(s string) ([]string, error) {
+					return nil, os.ErrNotExist
+				},
+			}
+			keys, err := dfs.keys()
+			require.NoError(t, err)
+			assert.Empty(t, keys)
+		})
+
+		t.Run("list error", func(t *testing.T) {
+			dfs.s = &testFs{
+				listResult: func(s string) ([]string, error) {
+					return nil, errors.New("test")
+				},
+			}
+			_, err := dfs.keys()
+			assert.Error(t, err)
+		})
+
+	})
+
+	t.Run("update", func(t *testing.T) {
+
+		dfs.s = &testFs{}
+
+		t.Run("update invalid key", func(t *testing.T) {
+			key := path.Join("foo", "bar")
+			err := dfs.update(key, nil)
+			assert.ErrorIs(t, err, NewKeyInvalid(key))
+		})
+
+		t.Run("update existing key", func(t *testing.T) {
+			locked := false
+			tl := &testLock{lockResult: func() error {
+				locked = true
+				return nil
+			}}
+			dfs.s = &testFs{
+				getlResult: func(s string) lock { return tl },
+				readResult: func(s string) ([]byte, error) {
+					if s == "root/foo" {
+						return []byte{1}, nil
+					}
+					return nil, os.ErrNotExist
+				},
+				writeVerify: func(s string, b []byte) {
+					assert.True(t, locked)
+					assert.Equal(t, "root/foo", s)
+					assert.Equal(t, []byte{1, 2}, b)
+				},
+			}
+			err := dfs.update("foo", func(old []byte, exists bool) ([]byte, error) {
+				assert.True(t, exists)
+				return append(old, 2), nil
+			})
+			assert.NoError(t, err)
+		})
+
+		t.Run("update missing key", func(t *testing.T) {
+			dfs.s = &testFs{
+				getlResult: func(s string) lock { return &testLock{} },
+				readResult: func(s string) ([]byte, error) {
+					return nil, os.ErrNotExist
+				},
+			}
+			err := dfs.update("foo", func(old []byte, exists bool) ([]byte, error) {
+				assert.False(t, exists)
+				assert.Nil(t, old)
+				return []byte{1}, nil
+			})
+			assert.NoError(t, err)
+		})
+
+		t.Run("skip update", func(t *testing.T) {
+			dfs.s = &testFs{
+				getlResult: func(s string) lock { return &testLock{} },
+				writeResult: func(s string, b []byte) error {
+					t.Fail()
+					return nil
+				},
+			}
+			err := dfs.update("foo", func(old []byte, exists bool) ([]byte, error) {
+				return nil, errSkip
+			})
+			assert.NoError(t, err)
+		})
+
+		t.Run("delete with update", func(t *testing.T) {
+			removed := false
+			dfs.s = &testFs{
+				getlResult: func(s string) lock { return &testLock{} },
+				removeVerify: func(s string) {
+					if s == "root/foo" {
+						removed = true
+					}
+				},
+				removeResult: func(s string) error {
+					return os.ErrNotExist
+				},
+			}
+			err := dfs.update("foo", func(old []byte, exists bool) ([]byte, error) {
+				return nil, ErrDelete
+			})
+			assert.NoError(t, err)
+			assert.True(t, removed)
+		})
+
+		t.Run("update errors", func(t *testing.T) {
+			testErr := errors.New("test")
+			dfs.s = &testFs{
+				getlResult: func(s string) lock {
+					return &testLock{lockResult: func() error { return testErr }}
+				},
+			}
+			assert.ErrorIs(t, dfs.update("foo", nil), testErr)
+
+			dfs.s = &testFs{
+				getlResult: func(s string) lock { return &testLock{} },
+				readResult: func(s string) ([]byte, error) { return nil, testErr },
+			}
+			assert.ErrorIs(t, dfs.update("foo", nil), testErr)
+
+			dfs.s = &testFs{
+				getlResult: func(s string) lock { return &testLock{} },
+			}
+			err := dfs.update("foo", func(old []byte, exists bool) ([]byte, error) {
+				return nil, testErr
+			})
+			assert.ErrorIs(t, err, testErr)
+		})
+
+	})
+
+	t.Run("stream", func(t *testing.T) {
+
+		t.Run("stream invalid key", func(t *testing.T) {
+			key := path.Join("foo", "bar")
+			err := dfs.storeStream(key, nil)
+			assert.ErrorIs(t, err, NewKeyInvalid(key))
+			_, err = dfs.loadStream(key)
+			assert.ErrorIs(t, err, NewKeyInvalid(key))
+		})
+
+		t.Run("store stream", func(t *testing.T) {
+			r := bytes.NewReader([]byte{1})
+			dfs.s = &testFs{
+				writeStreamResult: func(s string, rd io.Reader) error {
+					assert.Equal(t, "root/foo", s)
+					assert.Equal(t, r, rd)
+					return nil
+				},
+			}
+			assert.NoError(t, dfs.storeStream("foo", r))
+		})
+
+		t.Run("store stream with lock", func(t *testing.T) {
+			locked := false
+			dfs := &dirfs{root: "root", locking: true, s: &testFs{
+				getlResult: func(s string) lock {
+					return &testLock{lockResult: func() error {
+						locked = true
+						return nil
+					}}
+				},
+			}}
+			assert.NoError(t, dfs.storeStream("foo", nil))
+			assert.True(t, locked)
+		})
+
+		t.Run("load stream", func(t *testing.T) {
+			dfs.s = &testFs{
+				readStreamResult: func(s string) (io.ReadCloser, error) {
+					assert.Equal(t, "root/foo", s)
+					return io.NopCloser(bytes.NewReader([]byte{1})), nil
+				},
+			}
+			rc, err := dfs.loadStream("foo")
+			require.NoError(t, err)
+			b, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			assert.Equal(t, []byte{1}, b)
+		})
+
+		t.Run("load stream missing key", func(t *testing.T) {
+			dfs.s = &testFs{
+				readStreamResult: func(s string) (io.ReadCloser, error) {
+					return nil, os.ErrNotExist
+				},
+			}
+			_, err := dfs.loadStream("foo")
+			assert.ErrorIs(t, err, NewKeyNotFound("foo"))
+		})
+
+	})
+
+	t.Run("commit", func(t *testing.T) {
+
+		t.Run("commit invalid key", func(t *testing.T) {
+			written := false
+			dfs.s = &testFs{
+				writeVerify: func(s string, b []byte) { written = true },
+			}
+			key := path.Join("foo", "bar")
+			err := dfs.commit([]op{{Key: "foo"}, {Key: key}})
+			assert.ErrorIs(t, err, NewKeyInvalid(key))
+			assert.False(t, written)
+		})
+
+		t.Run("commit through journal", func(t *testing.T) {
+			var written, removed []string
+			dfs.s = &testFs{
+				getlResult: func(s string) lock { return &testLock{} },
+				writeVerify: func(s string, b []byte) {
+					written = append(written, s)
+				},
+				removeVerify: func(s string) {
+					removed = append(removed, s)
+				},
+			}
+			err := dfs.commit([]op{{Key: "foo", Val: []byte{1}}, {Key: "bar", Del: true}})
+			require.NoError(t, err)
+			assert.Equal(t, []string{"root/" + journal, "root/foo"}, written)
+			assert.Equal(t, []string{
+				"root/" + ttlDir + "/foo",
+				"root/bar",
+				"root/" + ttlDir + "/bar",
+				"root/" + journal,
+			}, removed)
+		})
+
+		t.Run("journal is flushed before the changes", func(t *testing.T) {
+			var flushed []string
+			dfs.s = &testFs{
+				getlResult: func(s string) lock { return &testLock{} },
+				flushResult: func(s string) error {
+					flushed = append(flushed, s)
+					return nil
+				},
+				writeVerify: func(s string, b []byte) {
+					if s != "root/"+journal {
+						assert.Len(t, flushed, 2, "written before the journal was flushed")
+					}
+				},
+			}
+			require.NoError(t, dfs.commit([]op{{Key: "foo", Val: []byte{1}}}))
+			assert.Equal(t, []string{"root/" + journal, "root"}, flushed)
+		})
+
+		t.Run("journal flush error", func(t *testing.T) {
+			var written, removed []string
+			dfs.s = &testFs{
+				getlResult:  func(s string) lock { return &testLock{} },
+				flushResult: func(s string) error { return errors.New("test") },
+				writeVerify: func(s string, b []byte) {
+					written = append(written, s)
+				},
+				removeVerify: func(s string) {
+					removed = append(removed, s)
+				},
+			}
+			assert.Error(t, dfs.commit([]op{{Key: "foo", Val: []byte{1}}}))
+			assert.Equal(t, []string{"root/" + journal}, written)
+			assert.Equal(t, []string{"root/" + journal}, removed)
+		})
+
+		t.Run("journal error", func(t *testing.T) {
+			dfs.s = &testFs{
+				getlResult: func(s string) lock { return &testLock{} },
+				writeResult: func(s string, b []byte) error {
+					return errors.New("test")
+				},
+			}
+			assert.Error(t, dfs.commit([]op{{Key: "foo"}}))
+		})
+
+		t.Run("pending journal is replayed first", func(t *testing.T) {
+			var pending bytes.Buffer
+			require.NoError(t, gob.NewEncoder(&pending).Encode([]op{{Key: "old", Val: []byte{2}}}))
+			var written []string
+			dfs.s = &testFs{
+				getlResult: func(s string) lock { return &testLock{} },
+				readResult: func(s string) ([]byte, error) {
+					if s == "root/"+journal && len(written) == 0 {
+						return pending.Bytes(), nil
+					}
+					return nil, os.ErrNotExist
+				},
+				writeVerify: func(s string, b []byte) {
+					written = append(written, s)
+				},
+			}
+			require.NoError(t, dfs.commit([]op{{Key: "foo", Val: []byte{1}}}))
+			assert.Equal(t, []string{"root/old", "root/" + journal, "root/foo"}, written)
+		})
+
+		t.Run("journal is kept on error", func(t *testing.T) {
+			dfs.s = &testFs{
+				getlResult: func(s string) lock { return &testLock{} },
+				writeResult: func(s string, b []byte) error {
+					if s == "root/foo" {
+						return errors.New("test")
+					}
+					return nil
+				},
+				removeResult: func(s string) error {
+					t.Fail()
+					return nil
+				},
+			}
+			assert.Error(t, dfs.commit([]op{{Key: "foo"}}))
+		})
+
+	})
+
+	t.Run("stat", func(t *testing.T) {
+
+		t.Run("stat invalid key", func(t *testing.T) {
+			key := path.Join("foo", "bar")
+			_, err := dfs.stat(key)
+			assert.ErrorIs(t, err, NewKeyInvalid(key))
+			_, err = dfs.has(key)
+			assert.ErrorIs(t, err, NewKeyInvalid(key))
+		})
+
+		t.Run("stat existing key", func(t *testing.T) {
+			dfs.s = &testFs{
+				statResult: func(s string) (KeyInfo, error) {
+					assert.Equal(t, "root/foo", s)
+					return KeyInfo{Size: 3, StoredSize: 3}, nil
+				},
+			}
+			info, err := dfs.stat("foo")
+			require.NoError(t, err)
+			assert.Equal(t, KeyInfo{Key: "foo", Size: 3, StoredSize: 3}, info)
+			ok, err := dfs.has("foo")
+			require.NoError(t, err)
+			assert.True(t, ok)
+		})
+
+		t.Run("stat missing key", func(t *testing.T) {
+			dfs.s = &testFs{
+				statResult: func(s string) (KeyInfo, error) {
+					return KeyInfo{}, os.ErrNotExist
+				},
+			}
+			_, err := dfs.stat("foo")
+			assert.ErrorIs(t, err, NewKeyNotFound("foo"))
+			ok, err := dfs.has("foo")
+			require.NoError(t, err)
+			assert.False(t, ok)
+		})
+
+		t.Run("stat error", func(t *testing.T) {
+			dfs.s = &testFs{
+				statResult: func(s string) (KeyInfo, error) {
+					return KeyInfo{}, errors.New("test")
+				},
+			}
+			_, err := dfs.stat("foo")
+			assert.Error(t, err)
+			_, err = dfs.has("foo")
+			assert.Error(t, err)
+		})
+
+	})
+
+	t.Run("clean", func(t *testing.T) {
+
+		t.Run("clean root and expiry directories", func(t *testing.T) {
+			var dirs []string
+			dfs.s = &testFs{
+				cleanResult: func(s string) error {
+					dirs = append(dirs, s)
+					return nil
+				},
+			}
+			assert.NoError(t, dfs.clean())
+			assert.Equal(t, []string{"root", path.Join("root", ttlDir)}, dirs)
+		})
+
+		t.Run("missing root directory", func(t *testing.T) {
+			dfs.s = &testFs{
+				cleanResult: func(s string) error {
+					return os.ErrNotExist
+				},
+			}
+			assert.NoError(t, dfs.clean())
+		})
+
+		t.Run("clean error", func(t *testing.T) {
+			dfs.s = &testFs{
+				cleanResult: func(s string) error {
+					return errors.New("test")
+				},
+			}
+			assert.Error(t, dfs.clean())
+		})
+
+	})
+
+	t.Run("key files outside of the root directory", func(t *testing.T) {
+		dfs.s = &testFs{
+			checkDirResult: func(s string) error {
+				return &os.PathError{Op: "lstat", Path: s, Err: errNotRegular}
+			},
+		}
+		defer func() { dfs.s = &testFs{} }()
+		assert.Error(t, dfs.store("foo", []byte{1}))
+		assert.Error(t, dfs.storeStream("foo", bytes.NewReader(nil)))
+		assert.Error(t, dfs.storeTTL("foo", []byte{1}, time.Now()))
+		_, err := dfs.load("foo")
+		assert.Error(t, err)
+		_, err = dfs.loadStream("foo")
+		assert.Error(t, err)
+		_, err = dfs.stat("foo")
+		assert.Error(t, err)
+		assert.Error(t, dfs.delete("foo"))
+		assert.Error(t, dfs.update("foo", func(b []byte, ok bool) ([]byte, error) { return b, nil }))
+		assert.Error(t, dfs.expire("foo", time.Now()))
+		assert.Error(t, dfs.commit([]op{{Key: "foo"}}))
+		assert.Error(t, dfs.reapKey("foo"))
+		assert.Error(t, dfs.apply(op{Key: "foo"}))
+	})
+
+	t.Run("buckets", func(t *testing.T) {
+
+		t.Run("list subdirectories", func(t *testing.T) {
+			dfs.s = &testFs{
+				dirsResult: func(s string) ([]string, error) {
+					assert.Equal(t, "root", s)
+					return []string{"foo"}, nil
+				},
+			}
+			names, err := dfs.buckets()
+			require.NoError(t, err)
+			assert.Equal(t, []string{"foo"}, names)
+		})
+
+		t.Run("missing root directory", func(t *testing.T) {
+			dfs.s = &testFs{
+				dirsResult: func(s string) ([]string, error) {
+					return nil, os.ErrNotExist
+				},
+			}
+			names, err := dfs.buckets()
+			require.NoError(t, err)
+			assert.Empty(t, names)
+		})
+
+		t.Run("drop bucket", func(t *testing.T) {
+			removed := ""
+			dfs.s = &testFs{
+				removeAllResult: func(s string) error {
+					removed = s
+					return nil
+				},
+			}
+			require.NoError(t, dfs.dropBucket("foo"))
+			assert.Equal(t, "root/foo", removed)
+		})
+
+		t.Run("drop invalid bucket", func(t *testing.T) {
+			dfs.s = &testFs{
+				removeAllResult: func(s string) error {
+					t.Fail()
+					return nil
+				},
+			}
+			for _, name := range []string{"", ".", "..", path.Join("foo", "bar"), ttlDir} {
+				assert.ErrorIs(t, dfs.dropBucket(name), NewKeyInvalid(name))
+			}
+		})
+
+	})
+}
+
+func Test_Sharding(t *testing.T) {
+
+	dfs := &dirfs{root: "root", depth: 2, width: 2}
+
+	t.Run("shard path", func(t *testing.T) {
+		p := dfs.path("foo")
+		assert.Equal(t, path.Join("root", shardDir, dfs.shard("foo"), "foo"), p)
+		assert.Regexp(t, `^root/\.picodb-shards/[0-9a-f]{2}/[0-9a-f]{2}/foo$`, p)
+		assert.Equal(t, p, dfs.path("foo"), "the path of a key is stable")
+		assert.Equal(t, path.Join("root", ttlDir, dfs.shard("foo"), "foo"), dfs.tpath("foo"))
+	})
+
+	t.Run("shard directories are created lazily", func(t *testing.T) {
+		var dirs []string
+		dfs.s = &testFs{
+			mkdirVerify: func(s string) {
+				dirs = append(dirs, s)
+			},
+		}
+		require.NoError(t, dfs.store("foo", []byte{1}))
+		assert.Equal(t, []string{path.Dir(dfs.path("foo"))}, dirs)
+	})
+
+	t.Run("list shard directories", func(t *testing.T) {
+		base := path.Join("root", shardDir)
+		dfs.s = &testFs{
+			dirsResult: func(s string) ([]string, error) {
+				switch s {
+				case base:
+					return []string{"00", "ff"}, nil
+				case path.Join(base, "00"):
+					return []string{"11"}, nil
+				case path.Join(base, "ff"):
+					return []string{"22", "33"}, nil
+				case path.Join("root", ttlDir):
+					return nil, os.ErrNotExist // no expiring keys
+				}
+				return nil, errors.New("unexpected")
+			},
+			listResult: func(s string) ([]string, error) {
+				switch s {
+				case path.Join(base, "00", "11"):
+					return []string{"foo"}, nil
+				case path.Join(base, "ff", "22"):
+					return []string{"bar", "baz"}, nil
+				case path.Join(base, "ff", "33"):
+					return nil, os.ErrNotExist // removed while listing
+				}
+				return nil, os.ErrNotExist
+			},
+		}
+		keys, err := dfs.keys()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"foo", "bar", "baz"}, keys)
+	})
+
+	t.Run("missing shard directory", func(t *testing.T) {
+		dfs.s = &testFs{
+			dirsResult: func(s string) ([]string, error) {
+				return nil, os.ErrNotExist
+			},
+		}
+		keys, err := dfs.keys()
+		require.NoError(t, err)
+		assert.Empty(t, keys)
+	})
+
+	t.Run("list error", func(t *testing.T) {
+		dfs.s = &testFs{
+			dirsResult: func(s string) ([]string, error) {
+				return nil, errors.New("test")
+			},
+		}
+		_, err := dfs.keys()
+		assert.Error(t, err)
+	})
 }
 
 func Test_Locking(t *testing.T) {
@@ -184,19 +819,67 @@ func Test_Locking(t *testing.T) {
 		assert.Error(t, err)
 	})
 
+	t.Run("lock with context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		tl.lockResult = func() error {
+			t.Fatal("blocking lock used with a cancellable context")
+			return nil
+		}
+		tl.tryLockResult = func(c context.Context) (bool, error) {
+			assert.Equal(t, ctx, c)
+			return true, nil
+		}
+		err := dfs.with(ctx).store("foo", []byte{})
+		assert.NoError(t, err)
+		assert.Nil(t, dfs.ctx)
+	})
+
+	t.Run("lock with cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		tl.tryLockResult = func(c context.Context) (bool, error) {
+			return false, c.Err()
+		}
+		err := dfs.with(ctx).store("foo", []byte{})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("lock with background context", func(t *testing.T) {
+		locked := false
+		tl.lockResult = func() error {
+			locked = true
+			return nil
+		}
+		err := dfs.with(context.Background()).store("foo", []byte{})
+		assert.NoError(t, err)
+		assert.True(t, locked)
+	})
+
 }
 
 // mock fs used for testing
 type testFs struct {
-	writeResult  func(string, []byte) error
-	writeVerify  func(string, []byte)
-	readResult   func(string) ([]byte, error)
-	readVerify   func(string)
-	removeResult func(string) error
-	removeVerify func(string)
-	mkdirResult  func(string) error
-	mkdirVerify  func(string)
-	getlResult   func(string) lock
+	writeResult       func(string, []byte) error
+	writeVerify       func(string, []byte)
+	readResult        func(string) ([]byte, error)
+	readVerify        func(string)
+	removeResult      func(string) error
+	removeVerify      func(string)
+	mkdirResult       func(string) error
+	mkdirVerify       func(string)
+	checkDirResult    func(string) error
+	getlResult        func(string) lock
+	listResult        func(string) ([]string, error)
+	cleanResult       func(string) error
+	statResult        func(string) (KeyInfo, error)
+	tailResult        func(string, int) ([]byte, error)
+	writeStreamResult func(string, io.Reader) error
+	readStreamResult  func(string) (io.ReadCloser, error)
+	dirsResult        func(string) ([]string, error)
+	removeAllResult   func(string) error
+	linkResult        func(string, string) error
+	flushResult       func(string) error
 }
 
 func (f *testFs) reset() {
@@ -208,7 +891,18 @@ func (f *testFs) reset() {
 	f.removeVerify = nil
 	f.mkdirResult = nil
 	f.mkdirVerify = nil
+	f.checkDirResult = nil
 	f.getlResult = nil
+	f.listResult = nil
+	f.cleanResult = nil
+	f.statResult = nil
+	f.tailResult = nil
+	f.writeStreamResult = nil
+	f.readStreamResult = nil
+	f.dirsResult = nil
+	f.removeAllResult = nil
+	f.linkResult = nil
+	f.flushResult = nil
 }
 
 func (f *testFs) write(name string, val []byte) error {
@@ -228,6 +922,12 @@ func (f *testFs) read(name string) ([]byte, error) {
 	if f.readResult != nil {
 		return f.readResult(name)
 	}
+	if strings.Contains(name, ttlDir) {
+		return nil, os.ErrNotExist // keys never expire, unless mocked
+	}
+	if strings.HasSuffix(name, journal) {
+		return nil, os.ErrNotExist // no interrupted commit, unless mocked
+	}
 	return nil, nil
 }
 
@@ -251,6 +951,17 @@ func (f *testFs) mkdir(name string) error {
 	return nil
 }
 
+func (f *testFs) checkDir(name string) error {
+	if f.checkDirResult != nil {
+		return f.checkDirResult(name)
+	}
+	return nil
+}
+
+func (f *testFs) lockName(name string) string {
+	return name + ".lock"
+}
+
 func (f *testFs) getl(name string) lock {
 	if f.getlResult != nil {
 		return f.getlResult(name)
@@ -258,9 +969,55 @@ func (f *testFs) getl(name string) lock {
 	return nil
 }
 
+func (f *testFs) list(name string) ([]string, error) {
+	if f.listResult != nil {
+		return f.listResult(name)
+	}
+	return nil, nil
+}
+
+func (f *testFs) clean(name string) error {
+	if f.cleanResult != nil {
+		return f.cleanResult(name)
+	}
+	return nil
+}
+
+func (f *testFs) stat(name string) (KeyInfo, error) {
+	if f.statResult != nil {
+		return f.statResult(name)
+	}
+	if strings.HasSuffix(name, ".lock") {
+		return KeyInfo{}, os.ErrNotExist
+	}
+	return KeyInfo{}, nil
+}
+
+func (f *testFs) tail(name string, n int) ([]byte, error) {
+	if f.tailResult != nil {
+		return f.tailResult(name, n)
+	}
+	return make([]byte, n), nil
+}
+
+func (f *testFs) writeStream(name string, r io.Reader) error {
+	if f.writeStreamResult != nil {
+		return f.writeStreamResult(name, r)
+	}
+	return nil
+}
+
+func (f *testFs) readStream(name string) (io.ReadCloser, error) {
+	if f.readStreamResult != nil {
+		return f.readStreamResult(name)
+	}
+	return io.NopCloser(bytes.NewReader(nil)), nil
+}
+
 type testLock struct {
-	lockResult   func() error
-	unlockResult func() error
+	lockResult    func() error
+	tryLockResult func(context.Context) (bool, error)
+	unlockResult  func() error
 }
 
 func (l *testLock) Lock() error {
@@ -270,9 +1027,48 @@ func (l *testLock) Lock() error {
 	return nil
 }
 
+func (l *testLock) TryLockContext(ctx context.Context, d time.Duration) (bool, error) {
+	if l.tryLockResult != nil {
+		return l.tryLockResult(ctx)
+	}
+	return true, nil
+}
+
 func (l *testLock) Unlock() error {
 	if l.unlockResult != nil {
 		return l.unlockResult()
 	}
 	return nil
 }
+
+func (f *testFs) dirs(name string) ([]string, error) {
+	if f.dirsResult != nil {
+		return f.dirsResult(name)
+	}
+	return nil, nil
+}
+
+func (f *testFs) removeAll(name string) error {
+	if f.removeAllResult != nil {
+		return f.removeAllResult(name)
+	}
+	return nil
+}
+
+func (f *testFs) link(oldname, newname string) error {
+	if f.linkResult != nil {
+		return f.linkResult(oldname, newname)
+	}
+	return nil
+}
+
+func (f *testFs) flush(name string) error {
+	if f.flushResult != nil {
+		return f.flushResult(name)
+	}
+	return nil
+}
+
+func (f *testFs) raw() storage {
+	return f
+}
@@ -1,6 +1,27 @@
 package picodb
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrDelete is returned from the function passed to Update
+// to delete the key instead of storing a new value.
+var ErrDelete = errors.New("delete key")
+
+// ErrClosed is returned by the operations of a closed PicoDb.
+var ErrClosed = errors.New("picodb is closed")
+
+// ErrInvalidOptions is returned by Open if the options are invalid.
+var ErrInvalidOptions = errors.New("invalid options")
+
+// ErrReadOnly is returned by the operations changing the store,
+// if it is opened in read-only mode.
+var ErrReadOnly = errors.New("picodb is read-only")
+
+// ErrNotSupported is returned by operations which are not supported
+// on the current platform, or by a custom Backend.
+var ErrNotSupported = errors.New("not supported")
 
 type KeyNotFound struct {
 	key string
@@ -16,8 +37,37 @@ func (e KeyNotFound) Error() string {
 	return fmt.Sprintf("key not found: %s", e.key)
 }
 
+// InvalidReason tells why a key is invalid.
+type InvalidReason int
+
+const (
+	ReasonUnspecified InvalidReason = iota // no particular reason
+	ReasonSeparator                        // the key contains a path separator
+	ReasonReserved                         // the key has the prefix of internal files
+	ReasonDotName                          // the key is empty, "." or ".."
+	ReasonTooLong                          // the key is too long for a file name
+	ReasonNotRegular                       // the file of the key is not a regular file, such as a symbolic link
+)
+
+func (r InvalidReason) String() string {
+	switch r {
+	case ReasonSeparator:
+		return "contains a path separator"
+	case ReasonReserved:
+		return "reserved name"
+	case ReasonDotName:
+		return "empty or dot name"
+	case ReasonTooLong:
+		return "too long"
+	case ReasonNotRegular:
+		return "not a regular file"
+	}
+	return "unspecified"
+}
+
 type KeyInvalid struct {
-	name string
+	name   string
+	reason InvalidReason
 }
 
 func NewKeyInvalid(name string) KeyInvalid {
@@ -26,6 +76,54 @@ func NewKeyInvalid(name string) KeyInvalid {
 	}
 }
 
+// newKeyInvalid returns a KeyInvalid error with the given reason.
+func newKeyInvalid(name string, reason InvalidReason) KeyInvalid {
+	return KeyInvalid{
+		name:   name,
+		reason: reason,
+	}
+}
+
 func (e KeyInvalid) Error() string {
-	return fmt.Sprintf("invalid key: %s", e.name)
+	if e.reason == ReasonUnspecified {
+		return fmt.Sprintf("invalid key: %s", e.name)
+	}
+	return fmt.Sprintf("invalid key: %s (%v)", e.name, e.reason)
+}
+
+// Reason returns why the key is invalid.
+func (e KeyInvalid) Reason() InvalidReason {
+	return e.reason
+}
+
+// Is reports whether the target is a KeyInvalid error of the same key.
+// A target without a reason matches any reason.
+func (e KeyInvalid) Is(target error) bool {
+	t, ok := target.(KeyInvalid)
+	if !ok {
+		return false
+	}
+	return t.name == e.name && (t.reason == ReasonUnspecified || t.reason == e.reason)
+}
+
+// CodecError is returned if the value of a key cannot be
+// encoded or decoded by the codec.
+type CodecError struct {
+	key string
+	err error
+}
+
+func NewCodecError(key string, err error) CodecError {
+	return CodecError{
+		key: key,
+		err: err,
+	}
+}
+
+func (e CodecError) Error() string {
+	return fmt.Sprintf("codec error for key %s: %v", e.key, e.err)
+}
+
+func (e CodecError) Unwrap() error {
+	return e.err
 }
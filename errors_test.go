@@ -1,6 +1,7 @@
 package picodb
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -34,4 +35,49 @@ func Test_InvalidName(t *testing.T) {
 		assert.Contains(t, e.Error(), "test")
 	})
 
+	t.Run("reason", func(t *testing.T) {
+		e := newKeyInvalid("test", ReasonDotName)
+		assert.Equal(t, ReasonDotName, e.Reason())
+		assert.Equal(t, ReasonUnspecified, NewKeyInvalid("test").Reason())
+		assert.Contains(t, e.Error(), ReasonDotName.String())
+	})
+
+	t.Run("equality with reason", func(t *testing.T) {
+		e := newKeyInvalid("test", ReasonNotRegular)
+		assert.ErrorIs(t, e, NewKeyInvalid("test"))
+		assert.ErrorIs(t, e, newKeyInvalid("test", ReasonNotRegular))
+		assert.NotErrorIs(t, e, newKeyInvalid("test", ReasonReserved))
+		assert.NotErrorIs(t, e, NewKeyInvalid("other"))
+		assert.NotErrorIs(t, e, NewKeyNotFound("test"))
+	})
+
+	t.Run("reason names", func(t *testing.T) {
+		for _, r := range []InvalidReason{ReasonSeparator, ReasonReserved, ReasonDotName, ReasonTooLong, ReasonNotRegular} {
+			assert.NotEqual(t, ReasonUnspecified.String(), r.String())
+		}
+	})
+
+}
+
+func Test_CodecError(t *testing.T) {
+
+	testErr := errors.New("test")
+
+	t.Run("equality", func(t *testing.T) {
+		e1 := NewCodecError("test", testErr)
+		e2 := NewCodecError("test", testErr)
+		assert.ErrorIs(t, e1, e2)
+	})
+
+	t.Run("unwrap", func(t *testing.T) {
+		e := NewCodecError("test", testErr)
+		assert.ErrorIs(t, e, testErr)
+	})
+
+	t.Run("error message", func(t *testing.T) {
+		e := NewCodecError("key", testErr)
+		assert.Contains(t, e.Error(), "key")
+		assert.Contains(t, e.Error(), "test")
+	})
+
 }
@@ -3,26 +3,163 @@ package picodb
 import (
 	"bytes"
 	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
 
-	"github.com/gofrs/flock"
+const (
+	reserved   = ".picodb"             // name prefix of internal files
+	tmpPrefix  = reserved + "-tmp-"    // name prefix of temporary files
+	lockPrefix = reserved + "-lock-"   // name prefix of lock files
+	journal    = reserved + "-journal" // name of the transaction journal
+	ttlDir     = reserved + "-ttl"     // name of the directory of expiry times
+	shardDir   = reserved + "-shards"  // name of the directory of sharded keys
+	tmpMaxAge  = time.Hour             // age after which temp files are stale
+	maxName    = 255                   // longest file name
 )
 
+// internal reports whether the file name belongs to an internal file.
+func internal(name string) bool {
+	return strings.HasPrefix(filepath.Base(name), reserved)
+}
+
 // fs is a basic storage implementation using the file system.
 type fs struct {
 	fmode os.FileMode // file mode used to create new files
 	dmode os.FileMode // file mode used to create new directories
+	sync  SyncMode    // durability of writes
+	tmp   string      // directory of temporary files, the directory of the written file if empty
 }
 
 // write bytes to a file indicated by name.
 func (f *fs) write(name string, val []byte) error {
-	return os.WriteFile(name, val, f.fmode)
+	return f.writeStream(name, bytes.NewReader(val))
+}
+
+// writeStream writes the contents of the reader to a file indicated by name.
+// The contents are written to a temporary file in the same directory,
+// or in the directory of temporary files if there is one, which is
+// synced and then renamed to the given name, so readers never see
+// a partially written file.
+func (f *fs) writeStream(name string, r io.Reader) error {
+	dir := filepath.Dir(name)
+	tdir := f.tmp
+	if tdir == "" {
+		tdir = dir
+	}
+	tmp, err := os.CreateTemp(tdir, tmpPrefix+"*")
+	if err != nil {
+		return err
+	}
+	if err := f.fill(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if f.sync >= SyncDir {
+		return syncDir(dir)
+	}
+	return nil
+}
+
+// fill writes the contents of the reader to the temporary file
+// and syncs it, if the sync mode requires it.
+func (f *fs) fill(tmp *os.File, r io.Reader) error {
+	if err := tmp.Chmod(f.fmode); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		return err
+	}
+	if f.sync >= SyncFile {
+		return tmp.Sync()
+	}
+	return nil
+}
+
+// syncDir flushes the directory entries of the given directory,
+// or the contents of the given file, to disk.
+func syncDir(name string) error {
+	d, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
 }
 
+// errNotRegular is reported for names which do not refer to a
+// regular file, such as symbolic links.
+var errNotRegular = errors.New("not a regular file")
+
 // read bytes from a file indicated by name.
 func (f *fs) read(name string) ([]byte, error) {
-	return os.ReadFile(name)
+	file, err := f.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// readStream opens the file indicated by name for reading.
+func (f *fs) readStream(name string) (io.ReadCloser, error) {
+	return f.open(name)
+}
+
+// open opens the regular file indicated by name for reading.
+// Symbolic links are not followed, see irregular for how
+// other kinds of files are reported.
+func (f *fs) open(name string) (*os.File, error) {
+	fi, err := os.Lstat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, irregular("open", name, fi.Mode())
+	}
+	// the file may have been replaced since
+	file, err := openNoFollow(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err = file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		file.Close()
+		return nil, irregular("open", name, fi.Mode())
+	}
+	return file, nil
+}
+
+// irregular returns the error reported for a name which refers to
+// a file of the given mode, which is not a regular file.
+// Directories, such as buckets, are reported as not existing,
+// other kinds of files with errNotRegular.
+func irregular(op, name string, mode os.FileMode) error {
+	if mode.IsDir() {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return &os.PathError{Op: op, Path: name, Err: errNotRegular}
 }
 
 // remove deletes the file by the given name
@@ -31,13 +168,197 @@ func (f *fs) remove(name string) error {
 }
 
 // mkdir creates the directory with the given name
+// When the sync mode includes directories, each newly created
+// directory is synced, from the deepest one up to the first parent
+// which already existed, so that none of them is lost.
 func (f *fs) mkdir(name string) error {
-	return os.MkdirAll(name, f.dmode)
+	if f.sync < SyncDir {
+		return os.MkdirAll(name, f.dmode)
+	}
+	created := missingDirs(name)
+	if len(created) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(name, f.dmode); err != nil {
+		return err
+	}
+	for _, dir := range created {
+		if err := syncDir(dir); err != nil {
+			return err
+		}
+	}
+	return syncDir(filepath.Dir(created[len(created)-1]))
 }
 
-// getl creates and returns a file-lock for the given name
+// missingDirs returns the name and those of its parents which do
+// not exist, from the deepest one up.
+func missingDirs(name string) []string {
+	var dirs []string
+	for dir := filepath.Clean(name); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			return dirs
+		}
+		dirs = append(dirs, dir)
+		if parent := filepath.Dir(dir); parent == dir {
+			return dirs
+		}
+	}
+}
+
+// checkDir returns an error if the given name is not a directory,
+// such as a symbolic link to one. A missing directory is not an error.
+func (f *fs) checkDir(name string) error {
+	fi, err := os.Lstat(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if !fi.IsDir() {
+		return &os.PathError{Op: "lstat", Path: name, Err: errNotRegular}
+	}
+	return nil
+}
+
+// getl creates and returns a file-lock for the given name.
+// The lock is held on a separate lock file next to the named file,
+// since writes replace the named file. A symbolic link in place of
+// the lock file is not followed, see newLock.
 func (f *fs) getl(name string) lock {
-	return flock.New(name)
+	return newLock(f.lockName(name))
+}
+
+// lockName returns the name of the lock file of the given name.
+// Names which would make the name of the lock file too long are
+// replaced by their hash.
+func (f *fs) lockName(name string) string {
+	dir, base := filepath.Split(name)
+	if len(lockPrefix+base) > maxName {
+		h := fnv.New64a()
+		h.Write([]byte(base))
+		base = fmt.Sprintf("%016x", h.Sum64())
+	}
+	return filepath.Join(dir, lockPrefix+base)
+}
+
+// list returns the names of the regular files in the given directory.
+// Internal files, such as temporary and lock files, are not listed.
+func (f *fs) list(name string) ([]string, error) {
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.Type().IsRegular() && !internal(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// dirs returns the names of the subdirectories of the given directory.
+// Internal directories are not listed.
+func (f *fs) dirs(name string) ([]string, error) {
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() && !internal(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// removeAll deletes the given directory with its contents.
+// A missing directory is not an error.
+func (f *fs) removeAll(name string) error {
+	return os.RemoveAll(name)
+}
+
+// link creates newname as a hard link to the file oldname.
+func (f *fs) link(oldname, newname string) error {
+	return os.Link(oldname, newname)
+}
+
+// flush syncs the given file or directory to disk, whatever
+// the sync mode.
+func (f *fs) flush(name string) error {
+	return syncDir(name)
+}
+
+// raw returns the storage itself, as it stores the bytes as they are.
+func (f *fs) raw() storage {
+	return f
+}
+
+// clean removes stale temporary files left behind in the given
+// directory by interrupted writes, and stale temporary directories,
+// such as the snapshots of interrupted backups.
+func (f *fs) clean(name string) error {
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), tmpPrefix) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		if time.Since(fi.ModTime()) < tmpMaxAge {
+			continue // may still be written by someone else
+		}
+		err = os.RemoveAll(filepath.Join(name, e.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// stat returns information about the regular file indicated by name.
+// Symbolic links are not followed, see irregular for how
+// other kinds of files are reported.
+func (f *fs) stat(name string) (KeyInfo, error) {
+	fi, err := os.Lstat(name)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	if !fi.Mode().IsRegular() {
+		return KeyInfo{}, irregular("stat", name, fi.Mode())
+	}
+	return KeyInfo{
+		Size:       fi.Size(),
+		StoredSize: fi.Size(),
+		ModTime:    fi.ModTime(),
+	}, nil
+}
+
+// tail reads the last n bytes of the file indicated by name.
+func (f *fs) tail(name string, n int) ([]byte, error) {
+	file, err := f.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if _, err := file.Seek(int64(-n), io.SeekEnd); err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(file, b); err != nil {
+		return nil, err
+	}
+	return b, nil
 }
 
 // fsc is a storage implementation storing compressed bytes using the file system
@@ -68,6 +389,23 @@ func (f *fsc) compress(val []byte) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// writeStream compresses the contents of the reader while writing
+// them to a file indicated by name.
+func (f *fsc) writeStream(name string, r io.Reader) error {
+	pr, pw := io.Pipe()
+	go func() {
+		z := gzip.NewWriter(pw)
+		_, err := io.Copy(z, r)
+		if err == nil {
+			err = z.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	err := f.s.writeStream(name, pr)
+	pr.Close() // stops the compression if the write failed early
+	return err
+}
+
 // read and uncompress bytes from a file indicated by name.
 func (f *fsc) read(name string) ([]byte, error) {
 	b, err := f.s.read(name)
@@ -86,6 +424,40 @@ func (f *fsc) uncompress(val []byte) ([]byte, error) {
 	return ioutil.ReadAll(z)
 }
 
+// readStream opens the file indicated by name for reading,
+// and uncompresses the contents while they are read.
+func (f *fsc) readStream(name string) (io.ReadCloser, error) {
+	rc, err := f.s.readStream(name)
+	if err != nil {
+		return nil, err
+	}
+	z, err := gzip.NewReader(rc)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return &gzipReadCloser{z: z, rc: rc}, nil
+}
+
+// gzipReadCloser uncompresses the contents of an underlying reader,
+// and closes it when closed.
+type gzipReadCloser struct {
+	z  *gzip.Reader
+	rc io.ReadCloser
+}
+
+func (g *gzipReadCloser) Read(p []byte) (int, error) {
+	return g.z.Read(p)
+}
+
+func (g *gzipReadCloser) Close() error {
+	err := g.z.Close()
+	if cerr := g.rc.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
 // remove is a proxy to the same method on fs
 func (f *fsc) remove(name string) error {
 	return f.s.remove(name)
@@ -96,7 +468,75 @@ func (f *fsc) mkdir(name string) error {
 	return f.s.mkdir(name)
 }
 
+// checkDir is a proxy to the same method on fs
+func (f *fsc) checkDir(name string) error {
+	return f.s.checkDir(name)
+}
+
 // getl is a proxy to the same method on fs
 func (f *fsc) getl(name string) lock {
 	return f.s.getl(name)
 }
+
+// lockName is a proxy to the same method on fs
+func (f *fsc) lockName(name string) string {
+	return f.s.lockName(name)
+}
+
+// list is a proxy to the same method on fs
+func (f *fsc) list(name string) ([]string, error) {
+	return f.s.list(name)
+}
+
+// clean is a proxy to the same method on fs
+func (f *fsc) clean(name string) error {
+	return f.s.clean(name)
+}
+
+// dirs is a proxy to the same method on fs
+func (f *fsc) dirs(name string) ([]string, error) {
+	return f.s.dirs(name)
+}
+
+// removeAll is a proxy to the same method on fs
+func (f *fsc) removeAll(name string) error {
+	return f.s.removeAll(name)
+}
+
+// link is a proxy to the same method on fs
+func (f *fsc) link(oldname, newname string) error {
+	return f.s.link(oldname, newname)
+}
+
+// flush is a proxy to the same method on fs
+func (f *fsc) flush(name string) error {
+	return f.s.flush(name)
+}
+
+// raw returns the underlying storage, which reads and writes
+// the compressed bytes.
+func (f *fsc) raw() storage {
+	return f.s
+}
+
+// stat returns information about the file indicated by name.
+// The uncompressed size is taken from the gzip trailer, so it
+// is only accurate for values smaller than 4GiB.
+func (f *fsc) stat(name string) (KeyInfo, error) {
+	info, err := f.s.stat(name)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	b, err := f.s.tail(name, 4)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	info.Size = int64(binary.LittleEndian.Uint32(b))
+	info.Compressed = true
+	return info, nil
+}
+
+// tail is a proxy to the same method on fs
+func (f *fsc) tail(name string, n int) ([]byte, error) {
+	return f.s.tail(name, n)
+}
@@ -2,9 +2,13 @@ package picodb
 
 import (
 	"errors"
+	"io"
 	"os"
 	"path"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -47,6 +51,31 @@ func TestFs(t *testing.T) {
 			assert.Equal(t, "test", string(val))
 		})
 
+		t.Run("overwrite data", func(t *testing.T) {
+			name := path.Join(dir, "baz")
+			defer os.Remove(name)
+			require.NoError(t, fs.write(name, []byte("test")))
+			require.NoError(t, fs.write(name, []byte("new")))
+			val, err := fs.read(name)
+			require.NoError(t, err)
+			assert.Equal(t, "new", string(val))
+		})
+
+		t.Run("no temp files left behind", func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "pico")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			require.NoError(t, fs.write(path.Join(dir, "foo"), []byte("test")))
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, "foo", entries[0].Name())
+		})
+
+		t.Run("write to missing directory", func(t *testing.T) {
+			assert.Error(t, fs.write(path.Join("missing", "foo"), []byte{}))
+		})
+
 		t.Run("file mode", func(t *testing.T) {
 			name := path.Join(dir, "bar")
 			defer os.Remove(name)
@@ -58,6 +87,35 @@ func TestFs(t *testing.T) {
 
 	})
 
+	t.Run("stream", func(t *testing.T) {
+		dir, err := os.MkdirTemp("", "pico")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		name := path.Join(dir, "foo")
+		require.NoError(t, fs.writeStream(name, strings.NewReader("test")))
+		rc, err := fs.readStream(name)
+		require.NoError(t, err)
+		defer rc.Close()
+		b, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		assert.Equal(t, "test", string(b))
+	})
+
+	t.Run("stream read error", func(t *testing.T) {
+		dir, err := os.MkdirTemp("", "pico")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		name := path.Join(dir, "foo")
+		err = fs.writeStream(name, iotest.ErrReader(errors.New("test")))
+		assert.Error(t, err)
+		assert.NoFileExists(t, name)
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
 	t.Run("remove", func(t *testing.T) {
 		t.Run("remove non-existing name", func(t *testing.T) {
 			assert.Error(t, fs.remove("missing"))
@@ -89,11 +147,233 @@ func TestFs(t *testing.T) {
 		assert.Equal(t, fs.dmode, fi.Mode().Perm())
 	})
 
+	t.Run("missing dirs", func(t *testing.T) {
+		dir := t.TempDir()
+		name := path.Join(dir, "a", "b", "c")
+		assert.Equal(t, []string{name, path.Join(dir, "a", "b"), path.Join(dir, "a")}, missingDirs(name))
+		assert.Empty(t, missingDirs(dir))
+
+		fs.sync = SyncDir
+		require.NoError(t, fs.mkdir(name))
+		fs.sync = SyncNone
+		assert.DirExists(t, name)
+		assert.Empty(t, missingDirs(name))
+	})
+
+	t.Run("sync modes", func(t *testing.T) {
+		for _, mode := range []SyncMode{SyncNone, SyncFile, SyncDir} {
+			fs.sync = mode
+
+			dir, err := os.MkdirTemp("", "pico")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			sub := path.Join(dir, "sub")
+			require.NoError(t, fs.mkdir(sub))
+			require.NoError(t, fs.mkdir(sub))
+
+			name := path.Join(sub, "foo")
+			require.NoError(t, fs.write(name, []byte("test")))
+			val, err := fs.read(name)
+			require.NoError(t, err)
+			assert.Equal(t, "test", string(val))
+		}
+		fs.sync = SyncNone
+	})
+
 	t.Run("getl", func(t *testing.T) {
 		l := fs.getl("foo")
 		assert.NotNil(t, l)
 	})
 
+	t.Run("getl uses separate lock file", func(t *testing.T) {
+		dir := t.TempDir()
+		l := fs.getl(path.Join(dir, "foo"))
+		require.NoError(t, l.Lock())
+		defer l.Unlock()
+		assert.FileExists(t, path.Join(dir, lockPrefix+"foo"))
+		assert.NoFileExists(t, path.Join(dir, "foo"))
+	})
+
+	t.Run("list", func(t *testing.T) {
+		dir, err := os.MkdirTemp("", "pico")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		require.NoError(t, fs.write(path.Join(dir, "foo"), []byte{}))
+		require.NoError(t, fs.write(path.Join(dir, "bar"), []byte{}))
+		require.NoError(t, fs.mkdir(path.Join(dir, "baz")))
+
+		names, err := fs.list(dir)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"foo", "bar"}, names)
+	})
+
+	t.Run("list skips internal files", func(t *testing.T) {
+		dir, err := os.MkdirTemp("", "pico")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		require.NoError(t, fs.write(path.Join(dir, "foo"), []byte{}))
+		require.NoError(t, fs.write(path.Join(dir, tmpPrefix+"foo-1"), []byte{}))
+		require.NoError(t, fs.write(path.Join(dir, lockPrefix+"foo"), []byte{}))
+
+		names, err := fs.list(dir)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"foo"}, names)
+	})
+
+	t.Run("stat", func(t *testing.T) {
+		dir, err := os.MkdirTemp("", "pico")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		name := path.Join(dir, "foo")
+		require.NoError(t, fs.write(name, []byte("test")))
+		info, err := fs.stat(name)
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), info.Size)
+		assert.Equal(t, int64(4), info.StoredSize)
+		assert.False(t, info.Compressed)
+		assert.WithinDuration(t, time.Now(), info.ModTime, time.Minute)
+
+		_, err = fs.stat(dir)
+		assert.True(t, os.IsNotExist(err))
+
+		_, err = fs.stat(path.Join(dir, "missing"))
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("symbolic links are not followed", func(t *testing.T) {
+		dir := t.TempDir()
+		target := path.Join(dir, "target")
+		link := path.Join(dir, "link")
+		require.NoError(t, fs.write(target, []byte("secret")))
+		require.NoError(t, os.Symlink(target, link))
+
+		_, err := fs.read(link)
+		assert.ErrorIs(t, err, errNotRegular)
+		_, err = fs.readStream(link)
+		assert.ErrorIs(t, err, errNotRegular)
+		_, err = fs.stat(link)
+		assert.ErrorIs(t, err, errNotRegular)
+		_, err = fs.tail(link, 1)
+		assert.ErrorIs(t, err, errNotRegular)
+
+		_, err = fs.read(dir)
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("checkDir", func(t *testing.T) {
+		dir := t.TempDir()
+		sub := path.Join(dir, "sub")
+		link := path.Join(dir, "link")
+		file := path.Join(dir, "file")
+		require.NoError(t, fs.mkdir(sub))
+		require.NoError(t, os.Symlink(sub, link))
+		require.NoError(t, fs.write(file, nil))
+
+		assert.NoError(t, fs.checkDir(sub))
+		assert.NoError(t, fs.checkDir(path.Join(dir, "missing")))
+		assert.ErrorIs(t, fs.checkDir(link), errNotRegular)
+		assert.ErrorIs(t, fs.checkDir(file), errNotRegular)
+	})
+
+	t.Run("tail", func(t *testing.T) {
+		dir, err := os.MkdirTemp("", "pico")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		name := path.Join(dir, "foo")
+		require.NoError(t, fs.write(name, []byte("test")))
+		b, err := fs.tail(name, 2)
+		require.NoError(t, err)
+		assert.Equal(t, "st", string(b))
+
+		_, err = fs.tail(name, 10)
+		assert.Error(t, err)
+	})
+
+	t.Run("clean", func(t *testing.T) {
+		dir, err := os.MkdirTemp("", "pico")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		stale := path.Join(dir, tmpPrefix+"foo-1")
+		fresh := path.Join(dir, tmpPrefix+"foo-2")
+		data := path.Join(dir, "foo")
+		for _, name := range []string{stale, fresh, data} {
+			require.NoError(t, os.WriteFile(name, []byte{}, 0644))
+		}
+		old := time.Now().Add(-2 * tmpMaxAge)
+		require.NoError(t, os.Chtimes(stale, old, old))
+		require.NoError(t, os.Chtimes(data, old, old))
+
+		require.NoError(t, fs.clean(dir))
+		assert.NoFileExists(t, stale)
+		assert.FileExists(t, fresh)
+		assert.FileExists(t, data)
+	})
+
+	t.Run("clean stale directory", func(t *testing.T) {
+		dir := t.TempDir()
+		stale := path.Join(dir, tmpPrefix+"snapshot-1")
+		require.NoError(t, fs.mkdir(stale))
+		require.NoError(t, os.WriteFile(path.Join(stale, "foo"), []byte{}, 0644))
+		old := time.Now().Add(-2 * tmpMaxAge)
+		require.NoError(t, os.Chtimes(stale, old, old))
+
+		require.NoError(t, fs.clean(dir))
+		assert.NoDirExists(t, stale)
+	})
+
+	t.Run("link", func(t *testing.T) {
+		dir := t.TempDir()
+		name := path.Join(dir, "foo")
+		link := path.Join(dir, "bar")
+		require.NoError(t, fs.write(name, []byte("foo")))
+		require.NoError(t, fs.link(name, link))
+		require.NoError(t, fs.write(name, []byte("baz")))
+
+		b, err := fs.read(link)
+		require.NoError(t, err)
+		assert.Equal(t, "foo", string(b), "replacing the file leaves the link alone")
+		assert.True(t, os.IsNotExist(fs.link(path.Join(dir, "missing"), link+"2")))
+	})
+
+	t.Run("clean missing directory", func(t *testing.T) {
+		err := fs.clean("missing")
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("list missing directory", func(t *testing.T) {
+		_, err := fs.list("missing")
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("dirs", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, fs.write(path.Join(dir, "foo"), []byte{}))
+		require.NoError(t, fs.mkdir(path.Join(dir, "bar")))
+		require.NoError(t, fs.mkdir(path.Join(dir, ttlDir)))
+
+		names, err := fs.dirs(dir)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"bar"}, names)
+	})
+
+	t.Run("remove all", func(t *testing.T) {
+		dir := t.TempDir()
+		sub := path.Join(dir, "foo")
+		require.NoError(t, fs.mkdir(sub))
+		require.NoError(t, fs.write(path.Join(sub, "bar"), []byte{}))
+
+		require.NoError(t, fs.removeAll(sub))
+		_, err := os.Stat(sub)
+		assert.True(t, os.IsNotExist(err))
+		assert.NoError(t, fs.removeAll(sub))
+	})
+
 }
 
 func Test_Compression(t *testing.T) {
@@ -152,6 +432,118 @@ func Test_Compression(t *testing.T) {
 		assert.Equal(t, val, v)
 	})
 
+	t.Run("stat reports uncompressed size", func(t *testing.T) {
+
+		val := []byte("this is a test")
+
+		var cap []byte
+
+		testFs.reset()
+		testFs.writeVerify = func(s string, b []byte) {
+			cap = b
+		}
+		testFs.statResult = func(s string) (KeyInfo, error) {
+			return KeyInfo{Size: int64(len(cap)), StoredSize: int64(len(cap))}, nil
+		}
+		testFs.tailResult = func(s string, n int) ([]byte, error) {
+			return cap[len(cap)-n:], nil
+		}
+
+		require.NoError(t, fs.write("foo", val))
+		info, err := fs.stat("foo")
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(val)), info.Size)
+		assert.Equal(t, int64(len(cap)), info.StoredSize)
+		assert.True(t, info.Compressed)
+	})
+
+	t.Run("stat error", func(t *testing.T) {
+		testFs.reset()
+		testFs.statResult = func(s string) (KeyInfo, error) {
+			return KeyInfo{}, testErr
+		}
+		_, err := fs.stat("foo")
+		assert.ErrorIs(t, err, testErr)
+
+		testFs.reset()
+		testFs.tailResult = func(s string, n int) ([]byte, error) {
+			return nil, testErr
+		}
+		_, err = fs.stat("foo")
+		assert.ErrorIs(t, err, testErr)
+	})
+
+	t.Run("raw bytes", func(t *testing.T) {
+		dir := t.TempDir()
+		fs := newStorage(Defaults().WithCompression())
+		name := path.Join(dir, "foo")
+		require.NoError(t, fs.write(name, []byte("foo")))
+
+		b, err := fs.raw().read(name)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0x1f, 0x8b}, b[:2])
+		plain := newStorage(Defaults())
+		assert.Same(t, plain, plain.raw())
+	})
+
+	t.Run("stream compressed bytes", func(t *testing.T) {
+		dir, err := os.MkdirTemp("", "pico")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		fs := newStorage(Defaults().WithCompression())
+		name := path.Join(dir, "foo")
+		val := strings.Repeat("test", 1000)
+		require.NoError(t, fs.writeStream(name, strings.NewReader(val)))
+
+		b, err := fs.read(name)
+		require.NoError(t, err)
+		assert.Equal(t, val, string(b))
+
+		rc, err := fs.readStream(name)
+		require.NoError(t, err)
+		b, err = io.ReadAll(rc)
+		require.NoError(t, err)
+		assert.NoError(t, rc.Close())
+		assert.Equal(t, val, string(b))
+
+		info, err := fs.stat(name)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(val)), info.Size)
+		assert.Less(t, info.StoredSize, info.Size)
+	})
+
+	t.Run("stream errors", func(t *testing.T) {
+		testFs.reset()
+		testFs.writeStreamResult = func(s string, r io.Reader) error {
+			return testErr
+		}
+		err := fs.writeStream("foo", strings.NewReader("test"))
+		assert.ErrorIs(t, err, testErr)
+
+		testFs.reset()
+		testFs.writeStreamResult = func(s string, r io.Reader) error {
+			_, err := io.ReadAll(r)
+			return err
+		}
+		err = fs.writeStream("foo", iotest.ErrReader(testErr))
+		assert.ErrorIs(t, err, testErr)
+
+		testFs.reset()
+		testFs.readStreamResult = func(s string) (io.ReadCloser, error) {
+			return nil, testErr
+		}
+		_, err = fs.readStream("foo")
+		assert.ErrorIs(t, err, testErr)
+
+		testFs.reset()
+		testFs.readStreamResult = func(s string) (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("not gzip")), nil
+		}
+		_, err = fs.readStream("foo")
+		assert.Error(t, err)
+	})
+
 	t.Run("test proxied calls", func(t *testing.T) {
 
 		name := "foo"
@@ -167,10 +559,21 @@ func Test_Compression(t *testing.T) {
 			assert.Equal(t, name, s)
 			return nil
 		}
+		testFs.listResult = func(s string) ([]string, error) {
+			assert.Equal(t, name, s)
+			return nil, nil
+		}
+		testFs.cleanResult = func(s string) error {
+			assert.Equal(t, name, s)
+			return nil
+		}
 
 		assert.NoError(t, fs.remove(name))
 		assert.NoError(t, fs.mkdir(name))
 		assert.Nil(t, fs.getl(name))
+		_, err := fs.list(name)
+		assert.NoError(t, err)
+		assert.NoError(t, fs.clean(name))
 
 	})
 
@@ -0,0 +1,23 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package picodb
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// openNoFollow opens the named file for reading, failing with
+// errNotRegular if it is a symbolic link.
+func openNoFollow(name string) (*os.File, error) {
+	file, err := os.OpenFile(name, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		if errors.Is(err, syscall.ELOOP) {
+			return nil, &os.PathError{Op: "open", Path: name, Err: errNotRegular}
+		}
+		return nil, err
+	}
+	return file, nil
+}
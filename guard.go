@@ -0,0 +1,137 @@
+package picodb
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// guard is a kvs which passes all operations on to the underlying
+// kvs, until it is closed. Operations on a closed guard return
+// ErrClosed.
+// Guards derived from a guard with with share its closed state.
+type guard struct {
+	k      kvs    // the underlying kvs
+	closed *int32 // set to 1 when closed
+}
+
+// newGuard returns an open guard of the given kvs.
+func newGuard(k kvs) *guard {
+	return &guard{k: k, closed: new(int32)}
+}
+
+// close the guard. Reports false if it was already closed.
+func (g *guard) close() bool {
+	return atomic.CompareAndSwapInt32(g.closed, 0, 1)
+}
+
+// check returns ErrClosed if the guard is closed.
+func (g *guard) check() error {
+	if atomic.LoadInt32(g.closed) != 0 {
+		return ErrClosed
+	}
+	return nil
+}
+
+func (g *guard) store(key string, val []byte) error {
+	if err := g.check(); err != nil {
+		return err
+	}
+	return g.k.store(key, val)
+}
+
+func (g *guard) load(key string) ([]byte, error) {
+	if err := g.check(); err != nil {
+		return nil, err
+	}
+	return g.k.load(key)
+}
+
+func (g *guard) delete(key string) error {
+	if err := g.check(); err != nil {
+		return err
+	}
+	return g.k.delete(key)
+}
+
+func (g *guard) keys() ([]string, error) {
+	if err := g.check(); err != nil {
+		return nil, err
+	}
+	return g.k.keys()
+}
+
+func (g *guard) has(key string) (bool, error) {
+	if err := g.check(); err != nil {
+		return false, err
+	}
+	return g.k.has(key)
+}
+
+func (g *guard) stat(key string) (KeyInfo, error) {
+	if err := g.check(); err != nil {
+		return KeyInfo{}, err
+	}
+	return g.k.stat(key)
+}
+
+func (g *guard) update(key string, fn updateFunc) error {
+	if err := g.check(); err != nil {
+		return err
+	}
+	return g.k.update(key, fn)
+}
+
+func (g *guard) commit(ops []op) error {
+	if err := g.check(); err != nil {
+		return err
+	}
+	return g.k.commit(ops)
+}
+
+func (g *guard) storeStream(key string, r io.Reader) error {
+	if err := g.check(); err != nil {
+		return err
+	}
+	return g.k.storeStream(key, r)
+}
+
+func (g *guard) loadStream(key string) (io.ReadCloser, error) {
+	if err := g.check(); err != nil {
+		return nil, err
+	}
+	return g.k.loadStream(key)
+}
+
+func (g *guard) storeTTL(key string, val []byte, exp time.Time) error {
+	if err := g.check(); err != nil {
+		return err
+	}
+	return g.k.storeTTL(key, val, exp)
+}
+
+func (g *guard) expire(key string, exp time.Time) error {
+	if err := g.check(); err != nil {
+		return err
+	}
+	return g.k.expire(key, exp)
+}
+
+func (g *guard) reap() error {
+	if err := g.check(); err != nil {
+		return err
+	}
+	return g.k.reap()
+}
+
+func (g *guard) open() error {
+	if err := g.check(); err != nil {
+		return err
+	}
+	return g.k.open()
+}
+
+func (g *guard) with(ctx context.Context) kvs {
+	return &guard{k: g.k.with(ctx), closed: g.closed}
+}
@@ -0,0 +1,62 @@
+package picodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Guard(t *testing.T) {
+
+	testErr := errors.New("test")
+	k := &testKvs{
+		storeMock: func(s string, b []byte) error { return testErr },
+		loadMock:  func(s string) ([]byte, error) { return nil, testErr },
+	}
+	g := newGuard(k)
+	v := g.with(context.Background())
+
+	t.Run("operations are passed on", func(t *testing.T) {
+		assert.ErrorIs(t, g.store("foo", nil), testErr)
+		_, err := g.load("foo")
+		assert.ErrorIs(t, err, testErr)
+		assert.NoError(t, g.check())
+	})
+
+	t.Run("close", func(t *testing.T) {
+		assert.True(t, g.close())
+		assert.False(t, g.close())
+		assert.ErrorIs(t, g.check(), ErrClosed)
+	})
+
+	t.Run("operations are rejected when closed", func(t *testing.T) {
+		_, err := g.load("foo")
+		assert.ErrorIs(t, err, ErrClosed)
+		_, err = g.keys()
+		assert.ErrorIs(t, err, ErrClosed)
+		_, err = g.has("foo")
+		assert.ErrorIs(t, err, ErrClosed)
+		_, err = g.stat("foo")
+		assert.ErrorIs(t, err, ErrClosed)
+		_, err = g.loadStream("foo")
+		assert.ErrorIs(t, err, ErrClosed)
+		assert.ErrorIs(t, g.store("foo", nil), ErrClosed)
+		assert.ErrorIs(t, g.delete("foo"), ErrClosed)
+		assert.ErrorIs(t, g.update("foo", nil), ErrClosed)
+		assert.ErrorIs(t, g.commit(nil), ErrClosed)
+		assert.ErrorIs(t, g.storeStream("foo", nil), ErrClosed)
+		assert.ErrorIs(t, g.storeTTL("foo", nil, time.Time{}), ErrClosed)
+		assert.ErrorIs(t, g.expire("foo", time.Time{}), ErrClosed)
+		assert.ErrorIs(t, g.reap(), ErrClosed)
+		assert.ErrorIs(t, g.open(), ErrClosed)
+	})
+
+	t.Run("derived guards are closed too", func(t *testing.T) {
+		assert.ErrorIs(t, v.store("foo", nil), ErrClosed)
+		assert.ErrorIs(t, g.with(context.Background()).store("foo", nil), ErrClosed)
+	})
+
+}
@@ -1,23 +1,72 @@
 package picodb
 
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
 // storage represents a generic interface which can read and write bytes based on a name.
 type storage interface {
-	write(string, []byte) error  // write bytes to a given name
-	read(string) ([]byte, error) // read bytes from a given name
-	remove(string) error         // delete a given name
-	mkdir(string) error          // make directory with the given name
-	getl(string) lock            // get a lock for the given name
+	write(string, []byte) error               // write bytes to a given name
+	read(string) ([]byte, error)              // read bytes from a given name
+	remove(string) error                      // delete a given name
+	mkdir(string) error                       // make directory with the given name
+	checkDir(string) error                    // check that a given name is a directory, not a symbolic link
+	getl(string) lock                         // get a lock for the given name
+	lockName(string) string                   // get the name of the lock file of the given name
+	list(string) ([]string, error)            // list file names in a given directory
+	clean(string) error                       // remove leftover temporary files from a given directory
+	stat(string) (KeyInfo, error)             // get information about a given name
+	tail(string, int) ([]byte, error)         // read the last n bytes of a given name
+	writeStream(string, io.Reader) error      // write the contents of a reader to a given name
+	readStream(string) (io.ReadCloser, error) // open a given name for reading
+	dirs(string) ([]string, error)            // list subdirectory names in a given directory
+	removeAll(string) error                   // delete a given directory with its contents
+	link(string, string) error                // create a hard link with the second name to the first one
+	flush(string) error                       // flush a given file or directory to disk
+	raw() storage                             // get the storage of the bytes as they are stored
 }
 
 // kvs represents a basic key-value store
 type kvs interface {
-	store(string, []byte) error  // store a key-value pair
-	load(string) ([]byte, error) // load a key
-	delete(string) error         // delete a key
+	store(string, []byte) error               // store a key-value pair
+	load(string) ([]byte, error)              // load a key
+	delete(string) error                      // delete a key
+	keys() ([]string, error)                  // list all keys
+	has(string) (bool, error)                 // check if a key exists
+	stat(string) (KeyInfo, error)             // get information about a key
+	update(string, updateFunc) error          // atomically update a key
+	commit([]op) error                        // atomically apply a list of changes
+	storeStream(string, io.Reader) error      // store a key with the contents of a reader
+	loadStream(string) (io.ReadCloser, error) // open a key for reading
+	storeTTL(string, []byte, time.Time) error // store a key-value pair expiring at a given time
+	expire(string, time.Time) error           // set the expiry time of a key
+	reap() error                              // delete expired keys
+	open() error                              // recover from an unclean shutdown
+	with(context.Context) kvs                 // bind the kvs to a context
+}
+
+// op is a single change of a transaction.
+// Fields are exported so that it can be encoded into the journal.
+type op struct {
+	Key string // the changed key
+	Val []byte // the new value
+	Del bool   // the key is deleted
 }
 
+// updateFunc computes the new value of a key from its current value.
+// Returning errSkip leaves the key unchanged, returning ErrDelete
+// deletes the key.
+type updateFunc func(old []byte, exists bool) ([]byte, error)
+
+// errSkip is returned by an updateFunc to skip the update.
+var errSkip = errors.New("skip update")
+
 // lock represents a lock on a given resource
 type lock interface {
-	Lock() error   // lock the resource
-	Unlock() error // unlock the resource
+	Lock() error                                                 // lock the resource
+	TryLockContext(context.Context, time.Duration) (bool, error) // lock the resource, retrying until the context is done
+	Unlock() error                                               // unlock the resource
 }
@@ -0,0 +1,308 @@
+package picodb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	iofs "io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FS returns a read-only view of the instance as a file system.
+// The keys are shown as files holding their values, which are
+// uncompressed if compression is enabled, and the buckets as
+// directories. Keys which are not valid file names in the view,
+// such as keys with a slash, are not shown.
+// The returned file system implements ReadDirFS, StatFS and
+// ReadFileFS as well.
+func (p *PicoDb) FS() iofs.FS {
+	return &dbFS{p: p}
+}
+
+// dbFS is the file system view of a PicoDb.
+type dbFS struct {
+	p *PicoDb
+}
+
+// Open opens the file or directory with the given name.
+func (f *dbFS) Open(name string) (iofs.File, error) {
+	fi, db, key, err := f.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		entries, err := f.entries(db)
+		if err != nil {
+			return nil, &iofs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &dbDir{fi: fi, entries: entries}, nil
+	}
+	rc, err := db.LoadReader(key)
+	if err != nil {
+		return nil, &iofs.PathError{Op: "open", Path: name, Err: fsErr(err)}
+	}
+	return &dbFile{fi: fi, rc: rc, db: db, key: key}, nil
+}
+
+// ReadDir returns the entries of the directory with the given name,
+// sorted by file name.
+func (f *dbFS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	fi, db, _, err := f.stat("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, &iofs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	entries, err := f.entries(db)
+	if err != nil {
+		return nil, &iofs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return entries, nil
+}
+
+// Stat returns information about the file or directory with the
+// given name.
+func (f *dbFS) Stat(name string) (iofs.FileInfo, error) {
+	fi, _, _, err := f.stat("stat", name)
+	return fi, err
+}
+
+// ReadFile returns the value of the key with the given name.
+// The value is read into a new slice, which the caller may modify.
+func (f *dbFS) ReadFile(name string) ([]byte, error) {
+	fi, db, key, err := f.stat("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, &iofs.PathError{Op: "readfile", Path: name, Err: errors.New("is a directory")}
+	}
+	rc, err := db.LoadReader(key)
+	if err != nil {
+		return nil, &iofs.PathError{Op: "readfile", Path: name, Err: fsErr(err)}
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// stat returns information about the given name, together with
+// the instance holding it, and the key if it is a file.
+func (f *dbFS) stat(op, name string) (iofs.FileInfo, *PicoDb, string, error) {
+	if !iofs.ValidPath(name) {
+		return nil, nil, "", &iofs.PathError{Op: op, Path: name, Err: iofs.ErrInvalid}
+	}
+	if name == "." {
+		return &dbInfo{name: ".", dir: true}, f.p, "", nil
+	}
+	db := f.p
+	elems := strings.Split(name, "/")
+	for _, elem := range elems[:len(elems)-1] {
+		b, err := f.bucket(db, elem)
+		if err != nil {
+			return nil, nil, "", &iofs.PathError{Op: op, Path: name, Err: err}
+		}
+		db = b
+	}
+	base := elems[len(elems)-1]
+	info, err := db.Stat(base)
+	if err == nil {
+		return &dbInfo{name: base, size: info.Size, mod: info.ModTime}, db, base, nil
+	}
+	if err := fsErr(err); !errors.Is(err, iofs.ErrNotExist) {
+		return nil, nil, "", &iofs.PathError{Op: op, Path: name, Err: err}
+	}
+	b, err := f.bucket(db, base)
+	if err != nil {
+		return nil, nil, "", &iofs.PathError{Op: op, Path: name, Err: err}
+	}
+	return &dbInfo{name: base, dir: true}, b, "", nil
+}
+
+// bucket returns the existing bucket of db with the given name.
+func (f *dbFS) bucket(db *PicoDb, name string) (*PicoDb, error) {
+	names, err := db.ListBuckets()
+	if err != nil {
+		return nil, fsErr(err)
+	}
+	for _, n := range names {
+		if n == name {
+			return db.bucket(name)
+		}
+	}
+	return nil, iofs.ErrNotExist
+}
+
+// entries returns the directory entries of the keys and the buckets
+// of db, sorted by name.
+func (f *dbFS) entries(db *PicoDb) ([]iofs.DirEntry, error) {
+	keys, err := db.Keys()
+	if err != nil {
+		return nil, err
+	}
+	buckets, err := db.ListBuckets()
+	if err != nil && !errors.Is(err, ErrNotSupported) {
+		return nil, err
+	}
+	entries := make([]iofs.DirEntry, 0, len(keys)+len(buckets))
+	dirs := make(map[string]bool, len(buckets))
+	for _, b := range buckets {
+		dirs[b] = true
+		entries = append(entries, iofs.FileInfoToDirEntry(&dbInfo{name: b, dir: true}))
+	}
+	for _, key := range keys {
+		if dirs[key] || strings.Contains(key, "/") || !iofs.ValidPath(key) {
+			continue
+		}
+		info, err := db.Stat(key)
+		if err != nil {
+			if errors.Is(err, NewKeyNotFound(key)) {
+				continue // deleted or expired since
+			}
+			return nil, err
+		}
+		entries = append(entries, iofs.FileInfoToDirEntry(&dbInfo{name: key, size: info.Size, mod: info.ModTime}))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// fsErr maps the errors of missing and invalid keys to
+// fs.ErrNotExist, and ErrNotSupported of missing buckets as well.
+func fsErr(err error) error {
+	var nf KeyNotFound
+	var inv KeyInvalid
+	switch {
+	case errors.As(err, &nf), errors.As(err, &inv), errors.Is(err, ErrNotSupported):
+		return iofs.ErrNotExist
+	}
+	return err
+}
+
+// dbInfo describes a key or a bucket.
+type dbInfo struct {
+	name string    // the key or the name of the bucket
+	size int64     // the uncompressed size of the value
+	mod  time.Time // the time the value was stored
+	dir  bool      // a bucket
+}
+
+func (i *dbInfo) Name() string       { return i.name }
+func (i *dbInfo) Size() int64        { return i.size }
+func (i *dbInfo) ModTime() time.Time { return i.mod }
+func (i *dbInfo) IsDir() bool        { return i.dir }
+func (i *dbInfo) Sys() interface{}   { return nil }
+
+func (i *dbInfo) Mode() iofs.FileMode {
+	if i.dir {
+		return iofs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// dbFile is an open key of the file system view.
+// It is seekable, so that it can be served by http.FileServer.
+// Values which are not read from a seekable file, such as compressed
+// values, are loaded into memory on the first seek.
+type dbFile struct {
+	fi  iofs.FileInfo
+	rc  io.ReadCloser
+	db  *PicoDb // the instance holding the key
+	key string  // the key of the value
+	pos int64   // the offset of the next read
+}
+
+func (f *dbFile) Stat() (iofs.FileInfo, error) { return f.fi, nil }
+func (f *dbFile) Close() error                 { return f.rc.Close() }
+
+func (f *dbFile) Read(b []byte) (int, error) {
+	n, err := f.rc.Read(b)
+	f.pos += int64(n)
+	return n, err
+}
+
+// Seek sets the offset of the next read.
+func (f *dbFile) Seek(offset int64, whence int) (int64, error) {
+	s, ok := f.rc.(io.Seeker)
+	if !ok {
+		var err error
+		if s, err = f.buffer(); err != nil {
+			return f.pos, err
+		}
+	}
+	pos, err := s.Seek(offset, whence)
+	if err != nil {
+		return f.pos, err
+	}
+	f.pos = pos
+	return pos, nil
+}
+
+// buffer loads the value into memory, and reads it from there
+// from the current offset on. The value which is being read is
+// buffered if nothing has been read yet, otherwise it is loaded
+// again.
+func (f *dbFile) buffer() (io.Seeker, error) {
+	rc := f.rc
+	if f.pos > 0 {
+		var err error
+		if rc, err = f.db.LoadReader(f.key); err != nil {
+			return nil, fsErr(err)
+		}
+		defer rc.Close()
+	}
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(b)
+	if _, err := r.Seek(f.pos, io.SeekStart); err != nil {
+		return nil, err
+	}
+	f.rc.Close()
+	f.rc = bufferedValue{r}
+	return r, nil
+}
+
+// bufferedValue is a value loaded into memory by dbFile.buffer.
+type bufferedValue struct {
+	*bytes.Reader
+}
+
+func (bufferedValue) Close() error { return nil }
+
+// dbDir is an open bucket, or the root of the file system view.
+type dbDir struct {
+	fi      iofs.FileInfo
+	entries []iofs.DirEntry // the entries not read yet
+}
+
+func (d *dbDir) Stat() (iofs.FileInfo, error) { return d.fi, nil }
+func (d *dbDir) Close() error                 { return nil }
+
+func (d *dbDir) Read(b []byte) (int, error) {
+	return 0, &iofs.PathError{Op: "read", Path: d.fi.Name(), Err: errors.New("is a directory")}
+}
+
+// ReadDir returns the next n entries of the directory, or all of
+// the remaining entries if n <= 0.
+func (d *dbDir) ReadDir(n int) ([]iofs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,182 @@
+package picodb
+
+import (
+	"errors"
+	"io"
+	iofs "io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FS(t *testing.T) {
+
+	open := func(t *testing.T, opt *PicoDbOptions) *PicoDb {
+		pico, err := Open(opt)
+		require.NoError(t, err)
+		t.Cleanup(func() { pico.Close() })
+		return pico
+	}
+
+	for name, opt := range map[string]*PicoDbOptions{
+		"plain":      Defaults(),
+		"compressed": Defaults().WithCompression(),
+		"sharded":    Defaults().WithSharding(1, 2),
+	} {
+		t.Run(name, func(t *testing.T) {
+			pico := open(t, opt.WithRootDir(t.TempDir()))
+			require.NoError(t, pico.StoreString("foo", "bar"))
+			require.NoError(t, pico.StoreString("baz", "qux"))
+			b, err := pico.Bucket("bucket")
+			require.NoError(t, err)
+			require.NoError(t, b.StoreString("nested", "value"))
+
+			fsys := pico.FS()
+			require.NoError(t, fstest.TestFS(fsys, "foo", "baz", "bucket/nested"))
+
+			v, err := iofs.ReadFile(fsys, "bucket/nested")
+			require.NoError(t, err)
+			assert.Equal(t, "value", string(v))
+			fi, err := iofs.Stat(fsys, "foo")
+			require.NoError(t, err)
+			assert.Equal(t, int64(3), fi.Size())
+			assert.False(t, fi.IsDir())
+			fi, err = iofs.Stat(fsys, "bucket")
+			require.NoError(t, err)
+			assert.True(t, fi.IsDir())
+			entries, err := iofs.ReadDir(fsys, ".")
+			require.NoError(t, err)
+			names := []string{}
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			assert.Equal(t, []string{"baz", "bucket", "foo"}, names)
+		})
+	}
+
+	t.Run("served over http", func(t *testing.T) {
+		for name, opt := range map[string]*PicoDbOptions{
+			"plain":      Defaults(),
+			"compressed": Defaults().WithCompression(),
+			"in memory":  Defaults().WithInMemory(),
+		} {
+			t.Run(name, func(t *testing.T) {
+				pico := open(t, opt.WithRootDir(t.TempDir()))
+				require.NoError(t, pico.StoreString("config", "0123456789"))
+				require.NoError(t, pico.StoreString("a.txt", "abcdef"))
+				srv := httptest.NewServer(http.FileServer(http.FS(pico.FS())))
+				defer srv.Close()
+
+				get := func(name, rng string) (int, string) {
+					req, err := http.NewRequest(http.MethodGet, srv.URL+"/"+name, nil)
+					require.NoError(t, err)
+					if rng != "" {
+						req.Header.Set("Range", rng)
+					}
+					resp, err := http.DefaultClient.Do(req)
+					require.NoError(t, err)
+					defer resp.Body.Close()
+					b, err := io.ReadAll(resp.Body)
+					require.NoError(t, err)
+					return resp.StatusCode, string(b)
+				}
+				code, body := get("config", "")
+				assert.Equal(t, http.StatusOK, code)
+				assert.Equal(t, "0123456789", body)
+				code, body = get("config", "bytes=2-4")
+				assert.Equal(t, http.StatusPartialContent, code)
+				assert.Equal(t, "234", body)
+				code, body = get("a.txt", "bytes=-2")
+				assert.Equal(t, http.StatusPartialContent, code)
+				assert.Equal(t, "ef", body)
+			})
+		}
+	})
+
+	t.Run("seek after reading", func(t *testing.T) {
+		pico := open(t, Defaults().WithRootDir(t.TempDir()).WithCompression())
+		require.NoError(t, pico.StoreString("foo", "0123456789"))
+		f, err := pico.FS().Open("foo")
+		require.NoError(t, err)
+		defer f.Close()
+		b := make([]byte, 3)
+		_, err = io.ReadFull(f, b)
+		require.NoError(t, err)
+		s := f.(io.Seeker)
+		pos, err := s.Seek(2, io.SeekCurrent)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), pos)
+		rest, err := io.ReadAll(f)
+		require.NoError(t, err)
+		assert.Equal(t, "56789", string(rest))
+		pos, err = s.Seek(-2, io.SeekEnd)
+		require.NoError(t, err)
+		assert.Equal(t, int64(8), pos)
+	})
+
+	t.Run("missing names", func(t *testing.T) {
+		fsys := open(t, Defaults().WithRootDir(t.TempDir())).FS()
+		for _, name := range []string{"missing", "missing/foo", ttlDir, journal} {
+			_, err := fsys.Open(name)
+			assert.ErrorIs(t, err, iofs.ErrNotExist, name)
+			_, err = iofs.Stat(fsys, name)
+			assert.ErrorIs(t, err, iofs.ErrNotExist, name)
+		}
+	})
+
+	t.Run("invalid names", func(t *testing.T) {
+		fsys := open(t, Defaults().WithRootDir(t.TempDir())).FS()
+		for _, name := range []string{"", "/foo", "../foo", "foo/"} {
+			_, err := fsys.Open(name)
+			assert.ErrorIs(t, err, iofs.ErrInvalid, name)
+		}
+	})
+
+	t.Run("expired keys are hidden", func(t *testing.T) {
+		pico := open(t, Defaults().WithRootDir(t.TempDir()))
+		require.NoError(t, pico.StoreWithTTL("foo", []byte("bar"), time.Millisecond))
+		time.Sleep(5 * time.Millisecond)
+		entries, err := iofs.ReadDir(pico.FS(), ".")
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+		_, err = iofs.ReadFile(pico.FS(), "foo")
+		assert.ErrorIs(t, err, iofs.ErrNotExist)
+	})
+
+	t.Run("keys which are not file names are hidden", func(t *testing.T) {
+		pico := open(t, Defaults().WithInMemory())
+		require.NoError(t, pico.StoreString("foo", "bar"))
+		require.NoError(t, pico.StoreString("a/b", "c"))
+		require.NoError(t, fstest.TestFS(pico.FS(), "foo"))
+		entries, err := iofs.ReadDir(pico.FS(), ".")
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "foo", entries[0].Name())
+	})
+
+	t.Run("read errors", func(t *testing.T) {
+		testErr := errors.New("test")
+		s := &testKvs{
+			statMock: func(key string) (KeyInfo, error) {
+				return KeyInfo{}, testErr
+			},
+		}
+		pico := &PicoDb{kvs: s, opt: Defaults()}
+		_, err := pico.FS().Open("foo")
+		assert.ErrorIs(t, err, testErr)
+	})
+
+	t.Run("closed instance", func(t *testing.T) {
+		pico := open(t, Defaults().WithRootDir(t.TempDir()))
+		fsys := pico.FS()
+		require.NoError(t, pico.Close())
+		_, err := fsys.Open(".")
+		assert.ErrorIs(t, err, ErrClosed)
+	})
+
+}
@@ -0,0 +1,117 @@
+package picodb
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+)
+
+// KeyEncoding controls how keys are mapped to file names.
+type KeyEncoding int
+
+const (
+	KeyEncodingNone    KeyEncoding = iota // use keys as file names, rejecting keys with separators
+	KeyEncodingPercent                    // percent-encode the characters which are not safe in file names
+	KeyEncodingBase64                     // encode keys with unpadded base64url
+)
+
+// file names of the empty key in the encodings which would
+// otherwise map it to an empty name
+const (
+	emptyPercent = "%"
+	emptyBase64  = "="
+)
+
+const upperhex = "0123456789ABCDEF"
+
+// encode returns the file name of the given key.
+func (e KeyEncoding) encode(key string) string {
+	switch e {
+	case KeyEncodingPercent:
+		return percentEncode(key)
+	case KeyEncodingBase64:
+		if key == "" {
+			return emptyBase64
+		}
+		return base64.RawURLEncoding.EncodeToString([]byte(key))
+	}
+	return key
+}
+
+// decode returns the key of the given file name.
+// An error is returned if the name is not the encoding of any key,
+// which is the case for files not created by picodb.
+func (e KeyEncoding) decode(name string) (string, error) {
+	var key string
+	switch e {
+	case KeyEncodingPercent:
+		if name == emptyPercent {
+			return "", nil
+		}
+		k, err := url.PathUnescape(name)
+		if err != nil {
+			return "", err
+		}
+		key = k
+	case KeyEncodingBase64:
+		if name == emptyBase64 {
+			return "", nil
+		}
+		b, err := base64.RawURLEncoding.DecodeString(name)
+		if err != nil {
+			return "", err
+		}
+		key = string(b)
+	default:
+		return name, nil
+	}
+	// two names must not decode to the same key
+	if e.encode(key) != name {
+		return "", fmt.Errorf("not an encoded key: %s", name)
+	}
+	return key, nil
+}
+
+// percentEncode escapes the bytes of the key which are not safe
+// in file names on common platforms, and a leading dot, so that
+// no key maps to ".", ".." or an internal name.
+func percentEncode(key string) string {
+	if key == "" {
+		return emptyPercent
+	}
+	n := 0
+	for i := 0; i < len(key); i++ {
+		if shouldEscape(key, i) {
+			n++
+		}
+	}
+	if n == 0 {
+		return key
+	}
+	b := make([]byte, 0, len(key)+2*n)
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if shouldEscape(key, i) {
+			b = append(b, '%', upperhex[c>>4], upperhex[c&15])
+		} else {
+			b = append(b, c)
+		}
+	}
+	return string(b)
+}
+
+// shouldEscape reports whether the i-th byte of the key is escaped.
+func shouldEscape(key string, i int) bool {
+	c := key[i]
+	switch {
+	case c < 0x20 || c == 0x7f:
+		return true
+	case c == '.':
+		return i == 0
+	}
+	switch c {
+	case '%', '/', '\\', '<', '>', ':', '"', '|', '?', '*':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,198 @@
+package picodb
+
+import (
+	iofs "io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testKeys = []string{
+	"",
+	".",
+	"..",
+	"foo",
+	"https://example.com/a/b?c=d",
+	`C:\dir\file`,
+	".picodb-journal",
+	"100%",
+	"tab\tnew\nline\x00nul\x7f",
+	"ünïcødé",
+}
+
+func Test_KeyEncoding(t *testing.T) {
+
+	for name, tc := range map[string]struct {
+		enc     KeyEncoding
+		foreign []string // names not created by the encoding
+	}{
+		"percent": {KeyEncodingPercent, []string{"%zz", "a%41", "%2e", ".foo", "a/b"}},
+		"base64":  {KeyEncodingBase64, []string{"%zz", "Zm9v=", "Zm9", ".foo", "a/b"}},
+	} {
+		enc := tc.enc
+		t.Run(name, func(t *testing.T) {
+
+			t.Run("round trip", func(t *testing.T) {
+				for _, key := range testKeys {
+					name := enc.encode(key)
+					assert.NotEmpty(t, name)
+					assert.NotEqual(t, ".", name)
+					assert.NotEqual(t, "..", name)
+					assert.False(t, internal(name))
+					assert.NotContains(t, name, "/")
+					assert.NotContains(t, name, `\`)
+					for _, c := range name {
+						assert.GreaterOrEqual(t, c, rune(0x20))
+					}
+					decoded, err := enc.decode(name)
+					require.NoError(t, err)
+					assert.Equal(t, key, decoded)
+				}
+			})
+
+			t.Run("foreign names are rejected", func(t *testing.T) {
+				for _, name := range tc.foreign {
+					_, err := enc.decode(name)
+					assert.Error(t, err, name)
+				}
+			})
+
+		})
+	}
+
+	t.Run("percent encoding is readable", func(t *testing.T) {
+		assert.Equal(t, "foo", KeyEncodingPercent.encode("foo"))
+		assert.Equal(t, "user%3A1", KeyEncodingPercent.encode("user:1"))
+		assert.Equal(t, "%2E.", KeyEncodingPercent.encode(".."))
+		assert.Equal(t, "%", KeyEncodingPercent.encode(""))
+	})
+
+	t.Run("no encoding", func(t *testing.T) {
+		assert.Equal(t, "a/b", KeyEncodingNone.encode("a/b"))
+		key, err := KeyEncodingNone.decode("a%41")
+		require.NoError(t, err)
+		assert.Equal(t, "a%41", key)
+	})
+
+}
+
+func Test_EncodedKeys(t *testing.T) {
+
+	for name, enc := range map[string]KeyEncoding{
+		"percent": KeyEncodingPercent,
+		"base64":  KeyEncodingBase64,
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			pico := New(Defaults().WithRootDir(dir).WithKeyEncoding(enc))
+			for _, key := range testKeys {
+				require.NoError(t, pico.StoreString(key, key), key)
+			}
+			for _, key := range testKeys {
+				s, err := pico.LoadString(key)
+				require.NoError(t, err, key)
+				assert.Equal(t, key, s)
+			}
+
+			keys, err := pico.Keys()
+			require.NoError(t, err)
+			assert.ElementsMatch(t, testKeys, keys)
+
+			// files not written by picodb are not listed
+			require.NoError(t, os.WriteFile(path.Join(dir, "%zz"), nil, 0644))
+			keys, err = pico.Keys()
+			require.NoError(t, err)
+			assert.Len(t, keys, len(testKeys))
+
+			page, err := pico.Scan("https://", 0, "")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"https://example.com/a/b?c=d"}, page.Keys)
+
+			require.NoError(t, pico.StoreWithTTL("a/b", nil, -time.Second))
+			has, err := pico.Has("a/b")
+			require.NoError(t, err)
+			assert.False(t, has)
+			require.NoError(t, pico.Reap())
+			entries, err := os.ReadDir(path.Join(dir, ttlDir))
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+
+			for _, key := range testKeys {
+				require.NoError(t, pico.Delete(key), key)
+			}
+			keys, err = pico.Keys()
+			require.NoError(t, err)
+			assert.Empty(t, keys)
+		})
+	}
+
+	t.Run("long keys are invalid", func(t *testing.T) {
+		for _, enc := range []KeyEncoding{KeyEncodingNone, KeyEncodingPercent, KeyEncodingBase64} {
+			pico := New(Defaults().WithRootDir(t.TempDir()).WithKeyEncoding(enc))
+			key := strings.Repeat("k", maxName+1)
+			assert.ErrorIs(t, pico.StoreString(key, ""), NewKeyInvalid(key))
+			key = strings.Repeat("/", maxName)
+			if enc != KeyEncodingNone {
+				// escaped, the key gets too long
+				assert.ErrorIs(t, pico.StoreString(key, ""), NewKeyInvalid(key))
+			}
+		}
+		pico := New(Defaults().WithRootDir(t.TempDir()))
+		key := strings.Repeat("k", maxName)
+		require.NoError(t, pico.StoreString(key, ""))
+		keys, err := pico.Keys()
+		require.NoError(t, err)
+		sort.Strings(keys)
+		assert.Equal(t, []string{key}, keys)
+	})
+
+	t.Run("longest keys", func(t *testing.T) {
+		dir := t.TempDir()
+		pico := New(Defaults().WithRootDir(dir).WithLocking().WithCompression())
+		defer pico.Close()
+		key := strings.Repeat("k", maxName)
+		require.NoError(t, pico.StoreString(key, "foo"))
+		require.NoError(t, pico.StoreWithTTL(key, []byte("bar"), time.Hour))
+		require.NoError(t, pico.Update(key, func(old []byte, exists bool) ([]byte, error) {
+			return append(old, '!'), nil
+		}))
+		require.NoError(t, pico.Txn(func(tx *Tx) error {
+			tx.StoreString("other", "baz")
+			return nil
+		}))
+		s, err := pico.LoadString(key)
+		require.NoError(t, err)
+		assert.Equal(t, "bar!", s)
+		require.NoError(t, pico.Delete(key))
+		has, err := pico.Has(key)
+		require.NoError(t, err)
+		assert.False(t, has)
+	})
+
+	t.Run("existing long files are usable", func(t *testing.T) {
+		dir := t.TempDir()
+		key := strings.Repeat("k", 240)
+		require.NoError(t, os.WriteFile(path.Join(dir, key), []byte("foo"), 0644))
+		pico := New(Defaults().WithRootDir(dir))
+		defer pico.Close()
+		n := 0
+		require.NoError(t, pico.ForEach(func(k string, val []byte) error {
+			assert.Equal(t, key, k)
+			assert.Equal(t, "foo", string(val))
+			n++
+			return nil
+		}))
+		assert.Equal(t, 1, n)
+		entries, err := iofs.ReadDir(pico.FS(), ".")
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+		require.NoError(t, pico.Delete(key))
+	})
+
+}
@@ -0,0 +1,89 @@
+package picodb
+
+import (
+	"context"
+	"io"
+	iofs "io/fs"
+	"time"
+)
+
+// KV is the set of operations of a PicoDb.
+// Code depending on KV instead of *PicoDb can be tested with an
+// in-memory PicoDb, see WithInMemory, or with a fake.
+type KV interface {
+	// basic operations
+	Store(key string, val []byte) error
+	StoreString(key, val string) error
+	Load(key string) ([]byte, error)
+	LoadString(key string) (string, error)
+	Delete(key string) error
+	Has(key string) (bool, error)
+	Stat(key string) (KeyInfo, error)
+	Close() error
+
+	// listing keys
+	Keys() ([]string, error)
+	Count() (int, error)
+	ForEach(fn func(key string, val []byte) error) error
+	Scan(prefix string, limit int, cursor string) (*Page, error)
+	Range(start, end string, limit int, cursor string) (*Page, error)
+
+	// non-string values
+	StoreValue(key string, v interface{}) error
+	LoadValue(key string, v interface{}) error
+
+	// streaming values
+	StoreReader(key string, r io.Reader) error
+	LoadReader(key string) (io.ReadCloser, error)
+	LoadTo(key string, w io.Writer) (int64, error)
+	Copy(dst, src string) error
+
+	// batches
+	StoreMany(vals map[string][]byte) error
+	LoadMany(keys []string) (map[string][]byte, error)
+	DeleteMany(keys []string) error
+
+	// contexts
+	StoreContext(ctx context.Context, key string, val []byte) error
+	LoadContext(ctx context.Context, key string) ([]byte, error)
+	DeleteContext(ctx context.Context, key string) error
+	UpdateContext(ctx context.Context, key string, fn func(old []byte, exists bool) ([]byte, error)) error
+	StoreReaderContext(ctx context.Context, key string, r io.Reader) error
+	LoadReaderContext(ctx context.Context, key string) (io.ReadCloser, error)
+	StoreManyContext(ctx context.Context, vals map[string][]byte) error
+	LoadManyContext(ctx context.Context, keys []string) (map[string][]byte, error)
+	DeleteManyContext(ctx context.Context, keys []string) error
+
+	// conditional stores and updates
+	StoreIfAbsent(key string, val []byte) (bool, error)
+	StoreIfPresent(key string, val []byte) (bool, error)
+	CompareAndSwap(key string, old, new []byte) (bool, error)
+	Update(key string, fn func(old []byte, exists bool) ([]byte, error)) error
+
+	// transactions
+	Txn(fn func(tx *Tx) error) error
+	TxnContext(ctx context.Context, fn func(tx *Tx) error) error
+
+	// expiry
+	StoreWithTTL(key string, val []byte, ttl time.Duration) error
+	Expire(key string, ttl time.Duration) error
+	Persist(key string) error
+	Reap() error
+
+	// buckets
+	Bucket(name string) (KV, error)
+	ListBuckets() ([]string, error)
+	DeleteBucket(name string) error
+
+	// watching changes
+	Watch(ctx context.Context, prefix string) (<-chan Event, error)
+
+	// file system view
+	FS() iofs.FS
+
+	// backup and restore
+	Backup(w io.Writer) error
+	Restore(r io.Reader) error
+}
+
+var _ KV = (*PicoDb)(nil)
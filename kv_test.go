@@ -0,0 +1,99 @@
+package picodb
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_InMemory(t *testing.T) {
+
+	t.Run("nothing is written to disk", func(t *testing.T) {
+		root := path.Join(t.TempDir(), "root")
+		pico, err := Open(Defaults().WithRootDir(root).WithInMemory())
+		require.NoError(t, err)
+		defer pico.Close()
+
+		require.NoError(t, pico.StoreString("foo", "bar"))
+		require.NoError(t, pico.StoreWithTTL("ttl", []byte("ttl"), time.Hour))
+		require.NoError(t, pico.Txn(func(tx *Tx) error {
+			tx.StoreString("baz", "qux")
+			return nil
+		}))
+		keys, err := pico.Keys()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"foo", "ttl", "baz"}, keys)
+
+		_, err = os.Stat(root)
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("empty root directory", func(t *testing.T) {
+		pico, err := Open(Defaults().WithRootDir("").WithInMemory())
+		require.NoError(t, err)
+		defer pico.Close()
+		require.NoError(t, pico.StoreString("foo", "bar"))
+		s, err := pico.LoadString("foo")
+		require.NoError(t, err)
+		assert.Equal(t, "bar", s)
+	})
+
+	t.Run("instances are separate", func(t *testing.T) {
+		p1 := New(Defaults().WithInMemory())
+		defer p1.Close()
+		p2 := New(Defaults().WithInMemory())
+		defer p2.Close()
+		require.NoError(t, p1.StoreString("foo", "bar"))
+		ok, err := p2.Has("foo")
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("buckets are not supported", func(t *testing.T) {
+		pico := New(Defaults().WithInMemory())
+		defer pico.Close()
+		b, err := pico.Bucket("foo")
+		assert.ErrorIs(t, err, ErrNotSupported)
+		assert.True(t, b == nil, "no bucket is returned")
+	})
+
+	t.Run("buckets through the interface", func(t *testing.T) {
+		var kv KV = New(Defaults().WithRootDir(t.TempDir()))
+		defer kv.Close()
+		b, err := kv.Bucket("foo")
+		require.NoError(t, err)
+		n, err := b.Bucket("bar")
+		require.NoError(t, err)
+		require.NoError(t, n.StoreString("foo", "bar"))
+		names, err := kv.ListBuckets()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"foo"}, names)
+		names, err = b.ListBuckets()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"bar"}, names)
+	})
+
+	t.Run("closed instance", func(t *testing.T) {
+		pico := New(Defaults().WithInMemory())
+		require.NoError(t, pico.Close())
+		assert.ErrorIs(t, pico.StoreString("foo", "bar"), ErrClosed)
+	})
+
+}
+
+func Test_KV(t *testing.T) {
+	var kv KV = New(Defaults().WithInMemory())
+	defer kv.Close()
+
+	require.NoError(t, kv.StoreString("foo", "bar"))
+	ok, err := kv.CompareAndSwap("foo", []byte("bar"), []byte("baz"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	s, err := kv.LoadString("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "baz", s)
+}
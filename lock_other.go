@@ -0,0 +1,18 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package picodb
+
+import "github.com/gofrs/flock"
+
+// removableLocks reports whether lock files can be removed by their
+// holder. flock.Flock does not notice the removal, so two lockers
+// could hold the lock on different files.
+const removableLocks = false
+
+// newLock returns a lock held on the lock file with the given name.
+// A symbolic link in place of the lock file cannot be refused on
+// this platform.
+func newLock(name string) lock {
+	return flock.New(name)
+}
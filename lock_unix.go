@@ -0,0 +1,138 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package picodb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileLock is an exclusive flock(2) lock on a lock file.
+// Unlike flock.Flock, it does not follow a symbolic link planted in
+// place of the lock file, so it never creates or locks a file
+// outside of the root directory. Locks of both are compatible.
+type fileLock struct {
+	name string   // the name of the lock file
+	file *os.File // the open lock file, while locked
+}
+
+// removableLocks reports whether lock files can be removed by their
+// holder, as lockers notice the removal.
+const removableLocks = true
+
+// newLock returns a lock held on the lock file with the given name.
+func newLock(name string) lock {
+	return &fileLock{name: name}
+}
+
+// Lock waits until the lock is acquired.
+func (l *fileLock) Lock() error {
+	_, err := l.flock(syscall.LOCK_EX)
+	return err
+}
+
+// TryLockContext tries to acquire the lock until it succeeds or
+// the context is done, waiting the given delay between the tries.
+func (l *fileLock) TryLockContext(ctx context.Context, retryDelay time.Duration) (bool, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		ok, err := l.flock(syscall.LOCK_EX | syscall.LOCK_NB)
+		if ok || err != nil {
+			return ok, err
+		}
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// Unlock releases the lock, and closes the lock file.
+func (l *fileLock) Unlock() error {
+	if l.file == nil {
+		return nil
+	}
+	err := syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	l.file = nil
+	return err
+}
+
+// flock opens the lock file and locks it with the given operation.
+// It reports false if the lock is held by someone else.
+// The lock file may be removed by its holder, see dropLock, so
+// a lock acquired on a removed lock file is given up, and the lock
+// is taken on the current lock file instead.
+func (l *fileLock) flock(how int) (bool, error) {
+	if l.file != nil {
+		return true, nil
+	}
+	for {
+		file, err := l.open()
+		if err != nil {
+			return false, err
+		}
+		for {
+			err = syscall.Flock(int(file.Fd()), how)
+			if err != syscall.EINTR {
+				break
+			}
+		}
+		if err != nil {
+			file.Close()
+			if err == syscall.EWOULDBLOCK {
+				return false, nil
+			}
+			return false, err
+		}
+		if current(file, l.name) {
+			l.file = file
+			return true, nil
+		}
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}
+}
+
+// current reports whether the open file is still the one with
+// the given name.
+func current(file *os.File, name string) bool {
+	fi, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	ni, err := os.Lstat(name)
+	return err == nil && os.SameFile(fi, ni)
+}
+
+// open opens or creates the lock file, failing with errNotRegular
+// if it is a symbolic link or not a regular file.
+func (l *fileLock) open() (*os.File, error) {
+	flag := os.O_CREATE | os.O_RDWR | syscall.O_NOFOLLOW | syscall.O_NONBLOCK | syscall.O_CLOEXEC
+	file, err := os.OpenFile(l.name, flag, 0600)
+	if err != nil {
+		if errors.Is(err, syscall.ELOOP) {
+			return nil, &os.PathError{Op: "open", Path: l.name, Err: errNotRegular}
+		}
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		file.Close()
+		return nil, &os.PathError{Op: "open", Path: l.name, Err: errNotRegular}
+	}
+	return file, nil
+}
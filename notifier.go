@@ -0,0 +1,117 @@
+package picodb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// notifier is a kvs which passes all operations on to the underlying
+// kvs, and publishes the successful changes to a hub.
+type notifier struct {
+	k kvs  // the underlying kvs
+	h *hub // receives the changes
+}
+
+func (n *notifier) store(key string, val []byte) error {
+	if err := n.k.store(key, val); err != nil {
+		return err
+	}
+	n.h.publish(EventPut, key)
+	return nil
+}
+
+func (n *notifier) load(key string) ([]byte, error) {
+	return n.k.load(key)
+}
+
+func (n *notifier) delete(key string) error {
+	if err := n.k.delete(key); err != nil {
+		return err
+	}
+	n.h.publish(EventDelete, key)
+	return nil
+}
+
+func (n *notifier) keys() ([]string, error) {
+	return n.k.keys()
+}
+
+func (n *notifier) has(key string) (bool, error) {
+	return n.k.has(key)
+}
+
+func (n *notifier) stat(key string) (KeyInfo, error) {
+	return n.k.stat(key)
+}
+
+// update publishes the change made by fn, if any.
+func (n *notifier) update(key string, fn updateFunc) error {
+	var res error
+	err := n.k.update(key, func(old []byte, exists bool) ([]byte, error) {
+		val, err := fn(old, exists)
+		res = err
+		return val, err
+	})
+	if err != nil {
+		return err
+	}
+	switch {
+	case res == nil:
+		n.h.publish(EventPut, key)
+	case errors.Is(res, ErrDelete):
+		n.h.publish(EventDelete, key)
+	}
+	return nil
+}
+
+func (n *notifier) commit(ops []op) error {
+	if err := n.k.commit(ops); err != nil {
+		return err
+	}
+	for _, o := range ops {
+		if o.Del {
+			n.h.publish(EventDelete, o.Key)
+		} else {
+			n.h.publish(EventPut, o.Key)
+		}
+	}
+	return nil
+}
+
+func (n *notifier) storeStream(key string, r io.Reader) error {
+	if err := n.k.storeStream(key, r); err != nil {
+		return err
+	}
+	n.h.publish(EventPut, key)
+	return nil
+}
+
+func (n *notifier) loadStream(key string) (io.ReadCloser, error) {
+	return n.k.loadStream(key)
+}
+
+func (n *notifier) storeTTL(key string, val []byte, exp time.Time) error {
+	if err := n.k.storeTTL(key, val, exp); err != nil {
+		return err
+	}
+	n.h.publish(EventPut, key)
+	return nil
+}
+
+func (n *notifier) expire(key string, exp time.Time) error {
+	return n.k.expire(key, exp)
+}
+
+func (n *notifier) reap() error {
+	return n.k.reap()
+}
+
+func (n *notifier) open() error {
+	return n.k.open()
+}
+
+func (n *notifier) with(ctx context.Context) kvs {
+	return &notifier{k: n.k.with(ctx), h: n.h}
+}
@@ -0,0 +1,116 @@
+package picodb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Notifier(t *testing.T) {
+
+	testErr := errors.New("test")
+	k := &testKvs{}
+	h := newHub()
+	n := &notifier{k: k, h: h}
+	ch := h.subscribe("")
+
+	next := func(t *testing.T, op EventOp, key string) {
+		select {
+		case ev := <-ch:
+			assert.Equal(t, op, ev.Op)
+			assert.Equal(t, key, ev.Key)
+			assert.False(t, ev.Time.IsZero())
+		default:
+			t.Fatalf("missing %v event of %s", op, key)
+		}
+	}
+
+	none := func(t *testing.T) {
+		select {
+		case ev := <-ch:
+			t.Fatalf("unexpected event %v", ev)
+		default:
+		}
+	}
+
+	t.Run("changes are published", func(t *testing.T) {
+		require.NoError(t, n.store("foo", nil))
+		next(t, EventPut, "foo")
+		require.NoError(t, n.storeTTL("foo", nil, time.Now()))
+		next(t, EventPut, "foo")
+		require.NoError(t, n.storeStream("foo", strings.NewReader("")))
+		next(t, EventPut, "foo")
+		require.NoError(t, n.delete("foo"))
+		next(t, EventDelete, "foo")
+		require.NoError(t, n.commit([]op{{Key: "foo"}, {Key: "bar", Del: true}}))
+		next(t, EventPut, "foo")
+		next(t, EventDelete, "bar")
+		none(t)
+	})
+
+	t.Run("reads are not published", func(t *testing.T) {
+		_, _ = n.load("foo")
+		_, _ = n.loadStream("foo")
+		_, _ = n.keys()
+		_, _ = n.has("foo")
+		_, _ = n.stat("foo")
+		none(t)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		defer k.reset()
+		var res error
+		k.updateMock = func(s string, fn updateFunc) error {
+			_, err := fn(nil, false)
+			if errors.Is(err, errSkip) || errors.Is(err, ErrDelete) {
+				return nil
+			}
+			return err
+		}
+		fn := func(old []byte, exists bool) ([]byte, error) {
+			return nil, res
+		}
+
+		require.NoError(t, n.update("foo", fn))
+		next(t, EventPut, "foo")
+
+		res = ErrDelete
+		require.NoError(t, n.update("foo", fn))
+		next(t, EventDelete, "foo")
+
+		res = errSkip
+		require.NoError(t, n.update("foo", fn))
+		none(t)
+
+		res = testErr
+		assert.ErrorIs(t, n.update("foo", fn), testErr)
+		none(t)
+	})
+
+	t.Run("failed changes are not published", func(t *testing.T) {
+		defer k.reset()
+		k.storeMock = func(s string, b []byte) error { return testErr }
+		k.deleteMock = func(s string) error { return testErr }
+		k.commitMock = func(o []op) error { return testErr }
+		k.storeStreamMock = func(s string, r io.Reader) error { return testErr }
+		k.storeTTLMock = func(s string, b []byte, exp time.Time) error { return testErr }
+		assert.ErrorIs(t, n.store("foo", nil), testErr)
+		assert.ErrorIs(t, n.delete("foo"), testErr)
+		assert.ErrorIs(t, n.commit([]op{{Key: "foo"}}), testErr)
+		assert.ErrorIs(t, n.storeStream("foo", nil), testErr)
+		assert.ErrorIs(t, n.storeTTL("foo", nil, time.Time{}), testErr)
+		none(t)
+	})
+
+	t.Run("with context", func(t *testing.T) {
+		require.NoError(t, n.with(context.Background()).store("foo", nil))
+		next(t, EventPut, "foo")
+	})
+
+}
@@ -1,16 +1,41 @@
 package picodb
 
-import "os"
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+)
+
+// SyncMode controls how writes are flushed to stable storage.
+type SyncMode int
+
+const (
+	SyncNone SyncMode = iota // leave flushing to the operating system
+	SyncFile                 // fsync the data file before it is renamed into place
+	SyncDir                  // fsync the data file and its parent directory
+)
 
 // PicoDbOptions contains options which are passed on to the
 // New function to create a PicoDb instace.
 type PicoDbOptions struct {
-	RootDir     string      // root directory
-	Compression bool        // enable compression at rest
-	Caching     bool        // enable in-memory cache
-	Locking     bool        // enable locking for write operations
-	FileMode    os.FileMode // file mode used to create files
-	DirMode     os.FileMode // file mode used to create directories
+	RootDir      string        // root directory
+	Compression  bool          // enable compression at rest
+	Caching      bool          // enable in-memory cache
+	Locking      bool          // enable locking for write operations
+	FileMode     os.FileMode   // file mode used to create files
+	DirMode      os.FileMode   // file mode used to create directories
+	Sync         SyncMode      // durability of writes
+	Workers      int           // number of parallel workers of batch operations
+	ReapInterval time.Duration // interval of deleting expired keys in the background, zero disables it
+	WatchRoot    bool          // watch the root directory, so that Watch reports the changes of other processes
+	Codec        Codec         // encodes the values of StoreValue and LoadValue, gob if nil
+	KeyEncoding  KeyEncoding   // maps keys to file names
+	ShardDepth   int           // number of nested shard directories of a key, zero for a flat layout
+	ShardWidth   int           // number of hex digits in the name of a shard directory
+	Backend      Backend       // custom storage used instead of the root directory, if not nil
+	InMemory     bool          // keep the keys in memory only instead of the root directory
+	ReadOnly     bool          // reject changes, and never write to the root directory
 }
 
 // Defaults returns a PicoDbOptions with sensible defaults.
@@ -21,6 +46,9 @@ func Defaults() *PicoDbOptions {
 		Caching:     false,
 		FileMode:    0644,
 		DirMode:     0744,
+		Sync:        SyncNone,
+		Workers:     runtime.NumCPU(),
+		Codec:       GobCodec{},
 	}
 }
 
@@ -53,3 +81,124 @@ func (p *PicoDbOptions) WithDirMode(mode os.FileMode) *PicoDbOptions {
 	p.DirMode = mode
 	return p
 }
+
+func (p *PicoDbOptions) WithSync(mode SyncMode) *PicoDbOptions {
+	p.Sync = mode
+	return p
+}
+
+func (p *PicoDbOptions) WithWorkers(n int) *PicoDbOptions {
+	p.Workers = n
+	return p
+}
+
+func (p *PicoDbOptions) WithReaper(interval time.Duration) *PicoDbOptions {
+	p.ReapInterval = interval
+	return p
+}
+
+func (p *PicoDbOptions) WithRootWatch() *PicoDbOptions {
+	p.WatchRoot = true
+	return p
+}
+
+func (p *PicoDbOptions) WithCodec(codec Codec) *PicoDbOptions {
+	p.Codec = codec
+	return p
+}
+
+func (p *PicoDbOptions) WithKeyEncoding(enc KeyEncoding) *PicoDbOptions {
+	p.KeyEncoding = enc
+	return p
+}
+
+// WithBackend stores the keys in the given backend instead of the
+// root directory. The options of the root directory do not apply.
+func (p *PicoDbOptions) WithBackend(b Backend) *PicoDbOptions {
+	p.Backend = b
+	return p
+}
+
+// WithInMemory keeps the keys in memory only, they are lost when
+// the instance is closed. The options of the root directory do
+// not apply.
+func (p *PicoDbOptions) WithInMemory() *PicoDbOptions {
+	p.InMemory = true
+	return p
+}
+
+// WithReadOnly opens the store in read-only mode. Changes are
+// rejected with ErrReadOnly, and nothing is written to the root
+// directory, not even lock files, so it can be on a read-only mount.
+func (p *PicoDbOptions) WithReadOnly() *PicoDbOptions {
+	p.ReadOnly = true
+	return p
+}
+
+// WithSharding stores the keys in nested shard directories derived
+// from a hash of the key, depth levels deep with names of width hex
+// digits each. The depth times the width can be at most 16.
+func (p *PicoDbOptions) WithSharding(depth, width int) *PicoDbOptions {
+	p.ShardDepth = depth
+	p.ShardWidth = width
+	return p
+}
+
+// maxShardDigits is the number of hex digits of the hash of a key.
+const maxShardDigits = 16
+
+// sharding returns the depth and width of the shard directories.
+// Values out of range, which are rejected by validate, are clamped.
+func (p *PicoDbOptions) sharding() (depth, width int) {
+	if p.ShardDepth <= 0 {
+		return 0, 0
+	}
+	width = p.ShardWidth
+	if width < 1 {
+		width = 1
+	}
+	if width > maxShardDigits {
+		width = maxShardDigits
+	}
+	depth = p.ShardDepth
+	if depth*width > maxShardDigits {
+		depth = maxShardDigits / width
+	}
+	return depth, width
+}
+
+// rooted reports whether the keys are stored in the root directory.
+func (p *PicoDbOptions) rooted() bool {
+	return p.Backend == nil && !p.InMemory
+}
+
+// validate checks that the options can be used to open a PicoDb.
+func (p *PicoDbOptions) validate() error {
+	switch {
+	case p == nil:
+		return fmt.Errorf("%w: missing options", ErrInvalidOptions)
+	case p.RootDir == "" && p.rooted():
+		return fmt.Errorf("%w: empty root directory", ErrInvalidOptions)
+	case p.Sync < SyncNone || p.Sync > SyncDir:
+		return fmt.Errorf("%w: unknown sync mode %d", ErrInvalidOptions, p.Sync)
+	case p.Workers < 0:
+		return fmt.Errorf("%w: negative number of workers", ErrInvalidOptions)
+	case p.ReapInterval < 0:
+		return fmt.Errorf("%w: negative reap interval", ErrInvalidOptions)
+	case p.KeyEncoding < KeyEncodingNone || p.KeyEncoding > KeyEncodingBase64:
+		return fmt.Errorf("%w: unknown key encoding %d", ErrInvalidOptions, p.KeyEncoding)
+	case p.ShardDepth < 0:
+		return fmt.Errorf("%w: negative shard depth", ErrInvalidOptions)
+	case p.ShardDepth > 0 && (p.ShardWidth < 1 || p.ShardDepth*p.ShardWidth > maxShardDigits):
+		return fmt.Errorf("%w: shard depth times width must be between 1 and %d", ErrInvalidOptions, maxShardDigits)
+	case p.ShardDepth > 0 && p.WatchRoot:
+		return fmt.Errorf("%w: the root cannot be watched with sharding", ErrInvalidOptions)
+	case p.Backend != nil && p.InMemory:
+		return fmt.Errorf("%w: a backend cannot be kept in memory", ErrInvalidOptions)
+	case p.InMemory && p.ReadOnly:
+		return fmt.Errorf("%w: an in-memory store cannot be read-only", ErrInvalidOptions)
+	case !p.rooted() && p.WatchRoot:
+		return fmt.Errorf("%w: the root cannot be watched without a root directory", ErrInvalidOptions)
+	}
+	return nil
+}
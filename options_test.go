@@ -3,6 +3,7 @@ package picodb
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -11,16 +12,29 @@ func Test_Defaults(t *testing.T) {
 	opt := Defaults()
 	assert.NotNil(t, opt)
 	assert.NotEmpty(t, opt.RootDir)
+	assert.Equal(t, SyncNone, opt.Sync)
+	assert.Greater(t, opt.Workers, 0)
 }
 
 func Test_Builders(t *testing.T) {
+	b := &testBackend{}
 	opt := Defaults().
 		WithRootDir("test").
 		WithCaching().
 		WithCompression().
 		WithLocking().
 		WithFileMode(0666).
-		WithDirMode(0777)
+		WithDirMode(0777).
+		WithSync(SyncDir).
+		WithWorkers(3).
+		WithReaper(time.Minute).
+		WithRootWatch().
+		WithCodec(JSONCodec{}).
+		WithKeyEncoding(KeyEncodingBase64).
+		WithSharding(2, 3).
+		WithBackend(b).
+		WithInMemory().
+		WithReadOnly()
 
 	assert.Equal(t, "test", opt.RootDir)
 	assert.True(t, opt.Caching)
@@ -28,4 +42,43 @@ func Test_Builders(t *testing.T) {
 	assert.True(t, opt.Locking)
 	assert.Equal(t, os.FileMode(0666), opt.FileMode)
 	assert.Equal(t, os.FileMode(0777), opt.DirMode)
+	assert.Equal(t, SyncDir, opt.Sync)
+	assert.Equal(t, 3, opt.Workers)
+	assert.Equal(t, time.Minute, opt.ReapInterval)
+	assert.True(t, opt.WatchRoot)
+	assert.Equal(t, JSONCodec{}, opt.Codec)
+	assert.Equal(t, KeyEncodingBase64, opt.KeyEncoding)
+	assert.Equal(t, 2, opt.ShardDepth)
+	assert.Equal(t, 3, opt.ShardWidth)
+	assert.Same(t, b, opt.Backend)
+	assert.True(t, opt.InMemory)
+	assert.True(t, opt.ReadOnly)
+}
+
+func Test_Validate(t *testing.T) {
+	assert.NoError(t, Defaults().validate())
+	assert.NoError(t, Defaults().WithSharding(2, 2).validate())
+	assert.NoError(t, Defaults().WithSharding(0, 0).validate())
+	assert.NoError(t, Defaults().WithRootDir("").WithBackend(&testBackend{}).validate())
+	assert.NoError(t, Defaults().WithRootDir("").WithInMemory().validate())
+
+	var nilOpt *PicoDbOptions
+	for _, opt := range []*PicoDbOptions{
+		nilOpt,
+		Defaults().WithRootDir(""),
+		Defaults().WithSync(SyncMode(42)),
+		Defaults().WithWorkers(-1),
+		Defaults().WithReaper(-time.Second),
+		Defaults().WithKeyEncoding(KeyEncoding(42)),
+		Defaults().WithSharding(-1, 2),
+		Defaults().WithSharding(2, 0),
+		Defaults().WithSharding(3, 6),
+		Defaults().WithSharding(1, 2).WithRootWatch(),
+		Defaults().WithBackend(&testBackend{}).WithRootWatch(),
+		Defaults().WithInMemory().WithRootWatch(),
+		Defaults().WithInMemory().WithBackend(&testBackend{}),
+		Defaults().WithInMemory().WithReadOnly(),
+	} {
+		assert.ErrorIs(t, opt.validate(), ErrInvalidOptions)
+	}
 }
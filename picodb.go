@@ -1,6 +1,7 @@
 package picodb
 
 import (
+	"errors"
 	"sync"
 
 	"github.com/google/uuid"
@@ -12,41 +13,171 @@ import (
 // PicoDb is always initialized with a root path, which will
 // contain the data.
 type PicoDb struct {
-	id  uuid.UUID      // the unique id of this picodb instance
-	opt *PicoDbOptions // picodb options
-	kvs kvs            // the key-value store backend
+	id       uuid.UUID          // the unique id of this picodb instance
+	opt      *PicoDbOptions     // picodb options
+	kvs      kvs                // the key-value store backend
+	guard    *guard             // rejects operations once closed
+	hub      *hub               // distributes changes to watchers
+	done     chan struct{}      // closed when the instance is closed
+	wg       sync.WaitGroup     // background goroutines
+	cmu      sync.Mutex         // orders closing with starting background goroutines
+	wmu      sync.Mutex         // guards watching
+	watching bool               // the root directory is watched
+	bmu      sync.Mutex         // guards buckets
+	buckets  map[string]*PicoDb // the open buckets by name
 }
 
 // New returns a new PicoDb instance.
+// Problems with the root directory only surface on the first
+// operation using it, use Open to detect them early.
+// If the options enable the reaper, expired keys are deleted
+// in the background until the instance is closed.
 func New(options *PicoDbOptions) *PicoDb {
+	p := newPicoDb(options)
+	// best effort, a failed recovery does not affect the store
+	_ = p.kvs.open()
+	p.start()
+	return p
+}
+
+// Open returns a new PicoDb instance.
+// Unlike New, Open validates the options, creates the root directory
+// if it does not exist yet, and makes sure that it is writable.
+// Leftovers of an unclean shutdown are cleaned up, and the errors
+// of doing so are returned as well.
+// With a custom backend or in memory, only the options are validated.
+// In read-only mode, the root directory must exist already, and it
+// is left as it is.
+func Open(options *PicoDbOptions) (*PicoDb, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	if options.rooted() {
+		d := newDirfs(options)
+		prepare := d.prepare
+		if options.ReadOnly {
+			prepare = d.exists
+		}
+		if err := prepare(); err != nil {
+			return nil, err
+		}
+	}
+	p := newPicoDb(options)
+	if err := p.kvs.open(); err != nil {
+		return nil, err
+	}
+	p.start()
+	return p, nil
+}
+
+// Close stops the background work of the instance, and closes
+// its buckets.
+// Operations on a closed instance return ErrClosed.
+func (p *PicoDb) Close() error {
+	p.cmu.Lock()
+	closed := p.guard.close()
+	p.cmu.Unlock()
+	if !closed {
+		return ErrClosed
+	}
+	p.closeBuckets()
+	close(p.done)
+	p.wg.Wait()
+	return nil
+}
+
+func newPicoDb(options *PicoDbOptions) *PicoDb {
+	h := newHub()
+	k := newKvs(options)
+	if options.ReadOnly {
+		k = &readonly{k: k}
+	}
+	if !options.WatchRoot {
+		// changes are seen in the root directory otherwise
+		k = &notifier{k: k, h: h}
+	}
+	g := newGuard(k)
 	return &PicoDb{
-		id:  uuid.New(),
-		kvs: newKvs(options),
-		opt: options,
+		id:    uuid.New(),
+		kvs:   g,
+		opt:   options,
+		guard: g,
+		hub:   h,
+		done:  make(chan struct{}),
+	}
+}
+
+// start the background work of the instance.
+// Expired keys are not reaped in read-only mode.
+func (p *PicoDb) start() {
+	if p.opt.ReapInterval > 0 && !p.opt.ReadOnly {
+		p.wg.Add(1)
+		go p.reaper(p.opt.ReapInterval)
 	}
 }
 
+// spawn adds n background goroutines to the ones Close waits for,
+// unless the instance is closed, in which case ErrClosed is returned
+// and the goroutines must not be started.
+func (p *PicoDb) spawn(n int) error {
+	p.cmu.Lock()
+	defer p.cmu.Unlock()
+	if err := p.check(); err != nil {
+		return err
+	}
+	p.wg.Add(n)
+	return nil
+}
+
+// check returns ErrClosed if the instance is closed.
+func (p *PicoDb) check() error {
+	if p.guard == nil {
+		return nil
+	}
+	return p.guard.check()
+}
+
 func newKvs(options *PicoDbOptions) kvs {
-	var dirfs = &dirfs{
-		root:    options.RootDir,
-		s:       newStorage(options),
-		locking: options.Locking,
+	if options.InMemory {
+		return &cache{m: &sync.Map{}}
+	}
+	var k kvs
+	if options.Backend != nil {
+		k = newAdapter(options.Backend)
+	} else {
+		k = newDirfs(options)
 	}
 	if !options.Caching {
-		return dirfs
+		return k
 	}
 	return &chain{
 		list: []kvs{
 			&cache{m: &sync.Map{}},
-			dirfs,
+			k,
 		},
 	}
 }
 
+func newDirfs(options *PicoDbOptions) *dirfs {
+	depth, width := options.sharding()
+	return &dirfs{
+		root:    options.RootDir,
+		s:       newStorage(options),
+		locking: options.Locking,
+		enc:     options.KeyEncoding,
+		depth:   depth,
+		width:   width,
+	}
+}
+
 func newStorage(opt *PicoDbOptions) storage {
 	fs := &fs{
 		fmode: opt.FileMode,
 		dmode: opt.DirMode,
+		sync:  opt.Sync,
+	}
+	if depth, _ := opt.sharding(); depth > 0 {
+		fs.tmp = opt.RootDir // shard directories are not cleaned up on startup
 	}
 	if opt.Compression {
 		return &fsc{fs}
@@ -86,3 +217,41 @@ func (p *PicoDb) LoadString(key string) (string, error) {
 func (p *PicoDb) Delete(key string) error {
 	return p.kvs.delete(key)
 }
+
+// Keys returns all keys in the store, in no particular order.
+func (p *PicoDb) Keys() ([]string, error) {
+	return p.kvs.keys()
+}
+
+// Count returns the number of keys in the store.
+func (p *PicoDb) Count() (int, error) {
+	keys, err := p.Keys()
+	if err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+// ForEach calls fn for every key-value pair in the store.
+// Keys deleted while iterating are skipped.
+// If fn returns an error, the iteration stops and the error
+// is returned.
+func (p *PicoDb) ForEach(fn func(key string, val []byte) error) error {
+	keys, err := p.Keys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		val, err := p.Load(key)
+		if err != nil {
+			if errors.Is(err, NewKeyNotFound(key)) {
+				continue
+			}
+			return err
+		}
+		if err := fn(key, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,14 +1,23 @@
 package picodb
 
 import (
+	"bytes"
+	"context"
+	"encoding/gob"
 	"errors"
+	"io"
 	"math/rand"
 	"os"
+	"path"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_New(t *testing.T) {
@@ -26,19 +35,133 @@ func Test_New(t *testing.T) {
 
 	t.Run("kvs with cache disabled", func(t *testing.T) {
 		pico := New(Defaults())
-		assert.IsType(t, &dirfs{}, pico.kvs)
+		assert.IsType(t, &dirfs{}, unwrap(pico.kvs))
 	})
 
 	t.Run("kvs with cache enabled", func(t *testing.T) {
 		pico := New(Defaults().WithCaching())
-		assert.IsType(t, &chain{}, pico.kvs)
-		s := pico.kvs.(*chain)
+		assert.IsType(t, &chain{}, unwrap(pico.kvs))
+		s := unwrap(pico.kvs).(*chain)
 		assert.IsType(t, &cache{}, s.list[0])
 		assert.IsType(t, &dirfs{}, s.list[1])
 	})
 
 }
 
+func Test_Open(t *testing.T) {
+
+	t.Run("open creates root directory", func(t *testing.T) {
+		dir := path.Join(t.TempDir(), "foo", "bar")
+		pico, err := Open(Defaults().WithRootDir(dir))
+		require.NoError(t, err)
+		defer pico.Close()
+		assert.DirExists(t, dir)
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := Open(nil)
+		assert.ErrorIs(t, err, ErrInvalidOptions)
+		_, err = Open(Defaults().WithRootDir(""))
+		assert.ErrorIs(t, err, ErrInvalidOptions)
+	})
+
+	t.Run("root is not a directory", func(t *testing.T) {
+		name := path.Join(t.TempDir(), "file")
+		require.NoError(t, os.WriteFile(name, []byte{}, 0644))
+		_, err := Open(Defaults().WithRootDir(name))
+		assert.Error(t, err)
+	})
+
+	t.Run("root is not writable", func(t *testing.T) {
+		if os.Getuid() == 0 {
+			t.Skip("permissions are not enforced for root")
+		}
+		dir := t.TempDir()
+		require.NoError(t, os.Chmod(dir, 0500))
+		defer os.Chmod(dir, 0700)
+		_, err := Open(Defaults().WithRootDir(dir))
+		assert.Error(t, err)
+	})
+
+	t.Run("open reports recovery errors", func(t *testing.T) {
+		dir := t.TempDir()
+		var buf bytes.Buffer
+		require.NoError(t, gob.NewEncoder(&buf).Encode([]op{{Key: "foo", Val: []byte("1")}}))
+		require.NoError(t, os.WriteFile(path.Join(dir, journal), buf.Bytes(), 0644))
+		// a directory in place of foo makes applying its change fail
+		require.NoError(t, os.Mkdir(path.Join(dir, "foo"), 0755))
+		_, err := Open(Defaults().WithRootDir(dir))
+		assert.Error(t, err)
+		assert.FileExists(t, path.Join(dir, journal))
+	})
+
+}
+
+func Test_Close(t *testing.T) {
+
+	pico, err := Open(Defaults().WithRootDir(t.TempDir()).WithReaper(time.Millisecond))
+	require.NoError(t, err)
+	require.NoError(t, pico.StoreString("foo", "bar"))
+	require.NoError(t, pico.Close())
+
+	t.Run("operations return ErrClosed", func(t *testing.T) {
+		assert.ErrorIs(t, pico.StoreString("foo", "bar"), ErrClosed)
+		_, err := pico.Load("foo")
+		assert.ErrorIs(t, err, ErrClosed)
+		assert.ErrorIs(t, pico.Delete("foo"), ErrClosed)
+		_, err = pico.Keys()
+		assert.ErrorIs(t, err, ErrClosed)
+		_, err = pico.LoadMany([]string{"foo"})
+		assert.ErrorIs(t, err, ErrClosed)
+		err = pico.Txn(func(tx *Tx) error {
+			t.Fail()
+			return nil
+		})
+		assert.ErrorIs(t, err, ErrClosed)
+	})
+
+	t.Run("close twice", func(t *testing.T) {
+		assert.ErrorIs(t, pico.Close(), ErrClosed)
+	})
+
+	t.Run("close while watching and opening buckets", func(t *testing.T) {
+		for i := 0; i < 50; i++ {
+			pico := New(Defaults().WithRootDir(t.TempDir()))
+			var ch <-chan Event
+			var b KV
+			var werr, berr error
+			start := make(chan struct{})
+			var wg sync.WaitGroup
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				<-start
+				ch, werr = pico.Watch(context.Background(), "")
+			}()
+			go func() {
+				defer wg.Done()
+				<-start
+				b, berr = pico.Bucket("b")
+			}()
+			close(start)
+			require.NoError(t, pico.Close())
+			wg.Wait()
+			if werr == nil {
+				_, ok := <-ch
+				assert.False(t, ok)
+			}
+			if berr == nil {
+				_, err := b.Keys()
+				assert.ErrorIs(t, err, ErrClosed)
+			}
+		}
+	})
+
+}
+
 func Test_Store(t *testing.T) {
 
 	s := &testKvs{}
@@ -142,16 +265,360 @@ func Test_Delete(t *testing.T) {
 	assert.ErrorIs(t, err, testErr)
 }
 
+func Test_LockFiles(t *testing.T) {
+	dir := t.TempDir()
+	locking := New(Defaults().WithRootDir(dir).WithLocking())
+	defer locking.Close()
+	plain := New(Defaults().WithRootDir(dir))
+	defer plain.Close()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, locking.StoreString("foo", "bar"))
+		require.NoError(t, locking.Delete("foo"))
+		// updates lock the key without locking enabled as well
+		require.NoError(t, plain.Update("bar", func([]byte, bool) ([]byte, error) {
+			return []byte("bar"), nil
+		}))
+		require.NoError(t, plain.Delete("bar"))
+	}
+	require.NoError(t, locking.StoreString("baz", "baz"))
+	require.NoError(t, locking.Update("baz", func([]byte, bool) ([]byte, error) {
+		return nil, ErrDelete
+	}))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, e := range entries {
+		if !removableLocks && strings.HasPrefix(e.Name(), lockPrefix) {
+			continue
+		}
+		assert.Equal(t, ttlDir, e.Name(), "left behind")
+	}
+}
+
+func Test_LockFilesExclusion(t *testing.T) {
+	dir := t.TempDir()
+	var inside int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// separate instances, as separate processes would be
+			pico := New(Defaults().WithRootDir(dir).WithLocking())
+			defer pico.Close()
+			for j := 0; j < 50; j++ {
+				err := pico.Update("foo", func(old []byte, exists bool) ([]byte, error) {
+					assert.Equal(t, int32(1), atomic.AddInt32(&inside, 1), "lock held twice")
+					defer atomic.AddInt32(&inside, -1)
+					time.Sleep(100 * time.Microsecond)
+					if exists {
+						return nil, ErrDelete // removes the lock file
+					}
+					return []byte("bar"), nil
+				})
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func Test_Traversal(t *testing.T) {
+
+	t.Run("keys outside the root are invalid", func(t *testing.T) {
+		dir := t.TempDir()
+		pico := New(Defaults().WithRootDir(path.Join(dir, "root")))
+		for _, key := range []string{"", ".", "..", "../foo", "foo/../../bar"} {
+			assert.ErrorIs(t, pico.StoreString(key, "foo"), NewKeyInvalid(key))
+			_, err := pico.Load(key)
+			assert.ErrorIs(t, err, NewKeyInvalid(key))
+		}
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("symbolic links are not followed", func(t *testing.T) {
+		dir := t.TempDir()
+		root := path.Join(dir, "root")
+		secret := path.Join(dir, "secret")
+		require.NoError(t, os.WriteFile(secret, []byte("secret"), 0644))
+		pico := New(Defaults().WithRootDir(root))
+		require.NoError(t, pico.StoreString("foo", "bar"))
+		require.NoError(t, os.Symlink(secret, path.Join(root, "link")))
+
+		_, err := pico.Load("link")
+		assert.ErrorIs(t, err, newKeyInvalid("link", ReasonNotRegular))
+		_, err = pico.LoadReader("link")
+		assert.ErrorIs(t, err, newKeyInvalid("link", ReasonNotRegular))
+		_, err = pico.Stat("link")
+		assert.ErrorIs(t, err, newKeyInvalid("link", ReasonNotRegular))
+		keys, err := pico.Keys()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"foo"}, keys)
+
+		// storing replaces the link, and leaves its target alone
+		require.NoError(t, pico.StoreString("link", "foo"))
+		b, err := os.ReadFile(secret)
+		require.NoError(t, err)
+		assert.Equal(t, "secret", string(b))
+		s, err := pico.LoadString("link")
+		require.NoError(t, err)
+		assert.Equal(t, "foo", s)
+	})
+
+	// outside returns a directory outside of the root,
+	// and a function which lists its entries
+	outside := func(t *testing.T, dir string) (string, func() []os.DirEntry) {
+		out := path.Join(dir, "outside")
+		require.NoError(t, os.Mkdir(out, 0755))
+		return out, func() []os.DirEntry {
+			entries, err := os.ReadDir(out)
+			require.NoError(t, err)
+			return entries
+		}
+	}
+
+	t.Run("symbolic link lock files are not followed", func(t *testing.T) {
+		dir := t.TempDir()
+		root := path.Join(dir, "root")
+		out, entries := outside(t, dir)
+		require.NoError(t, os.Mkdir(root, 0755))
+		require.NoError(t, os.Symlink(path.Join(out, "evil"), path.Join(root, lockPrefix+"foo")))
+		pico := New(Defaults().WithRootDir(root).WithLocking())
+
+		assert.Error(t, pico.StoreString("foo", "bar"))
+		_, err := pico.StoreIfAbsent("foo", []byte("bar"))
+		assert.Error(t, err)
+		assert.Empty(t, entries())
+	})
+
+	t.Run("symbolic link ttl directory is not followed", func(t *testing.T) {
+		dir := t.TempDir()
+		root := path.Join(dir, "root")
+		out, entries := outside(t, dir)
+		require.NoError(t, os.Mkdir(root, 0755))
+		require.NoError(t, os.Symlink(out, path.Join(root, ttlDir)))
+		require.NoError(t, os.WriteFile(path.Join(out, "foo"), []byte("0"), 0644))
+		pico := New(Defaults().WithRootDir(root))
+
+		err := pico.StoreWithTTL("bar", []byte("bar"), time.Hour)
+		assert.ErrorIs(t, err, newKeyInvalid("bar", ReasonNotRegular))
+		assert.ErrorIs(t, pico.StoreString("foo", "foo"), newKeyInvalid("foo", ReasonNotRegular))
+		assert.ErrorIs(t, pico.Delete("foo"), newKeyInvalid("foo", ReasonNotRegular))
+		_, err = pico.Load("foo")
+		assert.ErrorIs(t, err, newKeyInvalid("foo", ReasonNotRegular))
+		names := []string{}
+		for _, e := range entries() {
+			names = append(names, e.Name())
+		}
+		assert.Equal(t, []string{"foo"}, names)
+		_, err = os.Stat(path.Join(root, "bar"))
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("symbolic link shard directory is not followed", func(t *testing.T) {
+		dir := t.TempDir()
+		root := path.Join(dir, "root")
+		out, entries := outside(t, dir)
+		require.NoError(t, os.Mkdir(root, 0755))
+		require.NoError(t, os.Symlink(out, path.Join(root, shardDir)))
+		pico := New(Defaults().WithRootDir(root).WithSharding(2, 2))
+
+		assert.ErrorIs(t, pico.StoreString("foo", "bar"), newKeyInvalid("foo", ReasonNotRegular))
+		assert.ErrorIs(t, pico.Txn(func(tx *Tx) error {
+			tx.StoreString("foo", "bar")
+			return nil
+		}), newKeyInvalid("foo", ReasonNotRegular))
+		assert.Empty(t, entries())
+	})
+
+	t.Run("symbolic link bucket directory is not followed", func(t *testing.T) {
+		dir := t.TempDir()
+		root := path.Join(dir, "root")
+		out, entries := outside(t, dir)
+		require.NoError(t, os.Mkdir(root, 0755))
+		require.NoError(t, os.Symlink(out, path.Join(root, "bucket")))
+		pico := New(Defaults().WithRootDir(root))
+
+		_, err := pico.Bucket("bucket")
+		assert.ErrorIs(t, err, newKeyInvalid("bucket", ReasonNotRegular))
+		assert.Empty(t, entries())
+	})
+
+}
+
+func Test_ShardedLayout(t *testing.T) {
+	dir := t.TempDir()
+	pico, err := Open(Defaults().WithRootDir(dir).WithSharding(2, 2).WithLocking())
+	require.NoError(t, err)
+	defer pico.Close()
+
+	keys := []string{"foo", "bar", "baz"}
+	for _, key := range keys {
+		require.NoError(t, pico.StoreString(key, key))
+	}
+	require.NoError(t, pico.StoreWithTTL("ttl", []byte("ttl"), time.Hour))
+	require.NoError(t, pico.Txn(func(tx *Tx) error {
+		tx.Store("txn", []byte("txn"))
+		tx.Delete("baz")
+		return nil
+	}))
+	b, err := pico.Bucket("bucket")
+	require.NoError(t, err)
+	require.NoError(t, b.StoreString("foo", "bucket"))
+
+	for _, key := range []string{"foo", "bar", "ttl", "txn"} {
+		_, err := os.Stat(newDirfs(pico.opt).path(key))
+		assert.NoError(t, err)
+		_, err = os.Stat(path.Join(dir, key))
+		assert.True(t, os.IsNotExist(err))
+	}
+	s, err := pico.LoadString("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", s)
+	all, err := pico.Keys()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"foo", "bar", "ttl", "txn"}, all)
+	s, err = b.LoadString("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "bucket", s)
+	buckets, err := pico.ListBuckets()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bucket"}, buckets)
+
+	// expiry times are sharded the same way
+	d := newDirfs(pico.opt)
+	assert.Equal(t, path.Join(dir, ttlDir, d.shard("ttl"), "ttl"), d.tpath("ttl"))
+	assert.FileExists(t, d.tpath("ttl"))
+	assert.NoFileExists(t, path.Join(dir, ttlDir, "ttl"))
+	require.NoError(t, pico.StoreWithTTL("old", []byte("old"), time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, pico.Reap())
+	assert.NoFileExists(t, d.path("old"))
+	assert.NoFileExists(t, d.tpath("old"))
+}
+
+func Test_Keys(t *testing.T) {
+	s := &testKvs{}
+	pico := &PicoDb{
+		kvs: s,
+	}
+	testErr := errors.New("test")
+
+	t.Run("keys", func(t *testing.T) {
+		defer s.reset()
+		s.keysMock = func() ([]string, error) {
+			return []string{"foo", "bar"}, nil
+		}
+		keys, err := pico.Keys()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"foo", "bar"}, keys)
+	})
+
+	t.Run("count", func(t *testing.T) {
+		defer s.reset()
+		s.keysMock = func() ([]string, error) {
+			return []string{"foo", "bar"}, nil
+		}
+		n, err := pico.Count()
+		assert.NoError(t, err)
+		assert.Equal(t, 2, n)
+	})
+
+	t.Run("count error", func(t *testing.T) {
+		defer s.reset()
+		s.keysMock = func() ([]string, error) {
+			return nil, testErr
+		}
+		_, err := pico.Count()
+		assert.ErrorIs(t, err, testErr)
+	})
+
+}
+
+func Test_ForEach(t *testing.T) {
+	s := &testKvs{}
+	pico := &PicoDb{
+		kvs: s,
+	}
+	testErr := errors.New("test")
+
+	s.keysMock = func() ([]string, error) {
+		return []string{"foo", "missing", "bar"}, nil
+	}
+	s.loadMock = func(key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, NewKeyNotFound(key)
+		}
+		return []byte(key), nil
+	}
+
+	t.Run("visit all keys", func(t *testing.T) {
+		visited := map[string]string{}
+		err := pico.ForEach(func(key string, val []byte) error {
+			visited[key] = string(val)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"foo": "foo", "bar": "bar"}, visited)
+	})
+
+	t.Run("stop on error", func(t *testing.T) {
+		calls := 0
+		err := pico.ForEach(func(key string, val []byte) error {
+			calls++
+			return testErr
+		})
+		assert.ErrorIs(t, err, testErr)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("load error", func(t *testing.T) {
+		s.loadMock = func(key string) ([]byte, error) {
+			return nil, testErr
+		}
+		err := pico.ForEach(func(key string, val []byte) error {
+			return nil
+		})
+		assert.ErrorIs(t, err, testErr)
+	})
+
+}
+
 type testKvs struct {
-	storeMock  func(string, []byte) error
-	loadMock   func(string) ([]byte, error)
-	deleteMock func(string) error
+	storeMock       func(string, []byte) error
+	loadMock        func(string) ([]byte, error)
+	deleteMock      func(string) error
+	keysMock        func() ([]string, error)
+	hasMock         func(string) (bool, error)
+	statMock        func(string) (KeyInfo, error)
+	updateMock      func(string, updateFunc) error
+	commitMock      func([]op) error
+	storeStreamMock func(string, io.Reader) error
+	loadStreamMock  func(string) (io.ReadCloser, error)
+	storeTTLMock    func(string, []byte, time.Time) error
+	expireMock      func(string, time.Time) error
+	reapMock        func() error
+	openMock        func() error
+	withMock        func(context.Context) kvs
 }
 
 func (t *testKvs) reset() {
 	t.storeMock = nil
 	t.loadMock = nil
 	t.deleteMock = nil
+	t.keysMock = nil
+	t.hasMock = nil
+	t.statMock = nil
+	t.updateMock = nil
+	t.commitMock = nil
+	t.storeStreamMock = nil
+	t.loadStreamMock = nil
+	t.storeTTLMock = nil
+	t.expireMock = nil
+	t.reapMock = nil
+	t.openMock = nil
+	t.withMock = nil
 }
 
 func (t *testKvs) store(key string, val []byte) error {
@@ -175,6 +642,101 @@ func (t *testKvs) delete(key string) error {
 	return nil
 }
 
+func (t *testKvs) keys() ([]string, error) {
+	if t.keysMock != nil {
+		return t.keysMock()
+	}
+	return nil, nil
+}
+
+func (t *testKvs) has(key string) (bool, error) {
+	if t.hasMock != nil {
+		return t.hasMock(key)
+	}
+	return false, nil
+}
+
+func (t *testKvs) stat(key string) (KeyInfo, error) {
+	if t.statMock != nil {
+		return t.statMock(key)
+	}
+	return KeyInfo{}, nil
+}
+
+func (t *testKvs) update(key string, fn updateFunc) error {
+	if t.updateMock != nil {
+		return t.updateMock(key, fn)
+	}
+	return nil
+}
+
+func (t *testKvs) commit(ops []op) error {
+	if t.commitMock != nil {
+		return t.commitMock(ops)
+	}
+	return nil
+}
+
+func (t *testKvs) storeStream(key string, r io.Reader) error {
+	if t.storeStreamMock != nil {
+		return t.storeStreamMock(key, r)
+	}
+	return nil
+}
+
+func (t *testKvs) loadStream(key string) (io.ReadCloser, error) {
+	if t.loadStreamMock != nil {
+		return t.loadStreamMock(key)
+	}
+	return nil, nil
+}
+
+func (t *testKvs) storeTTL(key string, val []byte, exp time.Time) error {
+	if t.storeTTLMock != nil {
+		return t.storeTTLMock(key, val, exp)
+	}
+	return nil
+}
+
+func (t *testKvs) expire(key string, exp time.Time) error {
+	if t.expireMock != nil {
+		return t.expireMock(key, exp)
+	}
+	return nil
+}
+
+func (t *testKvs) reap() error {
+	if t.reapMock != nil {
+		return t.reapMock()
+	}
+	return nil
+}
+
+func (t *testKvs) open() error {
+	if t.openMock != nil {
+		return t.openMock()
+	}
+	return nil
+}
+
+func (t *testKvs) with(ctx context.Context) kvs {
+	if t.withMock != nil {
+		return t.withMock(ctx)
+	}
+	return t
+}
+
+// unwrap returns the kvs under the decorators added by New.
+func unwrap(k kvs) kvs {
+	if g, ok := k.(*guard); ok {
+		return unwrap(g.k)
+	}
+	if n, ok := k.(*notifier); ok {
+		return unwrap(n.k)
+	}
+	return k
+}
+
 var rnd *rand.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
 
 func Benchmark_Store(b *testing.B) {
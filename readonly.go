@@ -0,0 +1,75 @@
+package picodb
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// readonly is a kvs which passes the reads on to the underlying kvs,
+// and rejects all changes with ErrReadOnly.
+type readonly struct {
+	k kvs // the underlying kvs
+}
+
+func (r *readonly) store(key string, val []byte) error {
+	return ErrReadOnly
+}
+
+func (r *readonly) load(key string) ([]byte, error) {
+	return r.k.load(key)
+}
+
+func (r *readonly) delete(key string) error {
+	return ErrReadOnly
+}
+
+func (r *readonly) keys() ([]string, error) {
+	return r.k.keys()
+}
+
+func (r *readonly) has(key string) (bool, error) {
+	return r.k.has(key)
+}
+
+func (r *readonly) stat(key string) (KeyInfo, error) {
+	return r.k.stat(key)
+}
+
+func (r *readonly) update(key string, fn updateFunc) error {
+	return ErrReadOnly
+}
+
+func (r *readonly) commit(ops []op) error {
+	return ErrReadOnly
+}
+
+func (r *readonly) storeStream(key string, rd io.Reader) error {
+	return ErrReadOnly
+}
+
+func (r *readonly) loadStream(key string) (io.ReadCloser, error) {
+	return r.k.loadStream(key)
+}
+
+func (r *readonly) storeTTL(key string, val []byte, exp time.Time) error {
+	return ErrReadOnly
+}
+
+func (r *readonly) expire(key string, exp time.Time) error {
+	return ErrReadOnly
+}
+
+func (r *readonly) reap() error {
+	return ErrReadOnly
+}
+
+// open does nothing, as cleaning up after an unclean shutdown
+// would change the store.
+func (r *readonly) open() error {
+	return nil
+}
+
+func (r *readonly) with(ctx context.Context) kvs {
+	return &readonly{k: r.k.with(ctx)}
+}
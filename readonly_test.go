@@ -0,0 +1,147 @@
+package picodb
+
+import (
+	"context"
+	iofs "io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Readonly(t *testing.T) {
+
+	k := &testKvs{}
+	r := &readonly{k: k}
+
+	t.Run("changes are rejected", func(t *testing.T) {
+		defer k.reset()
+		fail := func() { t.Fatal("change passed on") }
+		k.storeMock = func(string, []byte) error { fail(); return nil }
+		k.deleteMock = func(string) error { fail(); return nil }
+		k.updateMock = func(string, updateFunc) error { fail(); return nil }
+		k.commitMock = func([]op) error { fail(); return nil }
+		k.reapMock = func() error { fail(); return nil }
+		k.openMock = func() error { fail(); return nil }
+
+		assert.ErrorIs(t, r.store("foo", nil), ErrReadOnly)
+		assert.ErrorIs(t, r.delete("foo"), ErrReadOnly)
+		assert.ErrorIs(t, r.update("foo", nil), ErrReadOnly)
+		assert.ErrorIs(t, r.commit([]op{{Key: "foo"}}), ErrReadOnly)
+		assert.ErrorIs(t, r.storeStream("foo", strings.NewReader("")), ErrReadOnly)
+		assert.ErrorIs(t, r.storeTTL("foo", nil, time.Now()), ErrReadOnly)
+		assert.ErrorIs(t, r.expire("foo", time.Time{}), ErrReadOnly)
+		assert.ErrorIs(t, r.reap(), ErrReadOnly)
+		assert.NoError(t, r.open())
+	})
+
+	t.Run("reads are passed on", func(t *testing.T) {
+		defer k.reset()
+		k.loadMock = func(string) ([]byte, error) { return []byte("bar"), nil }
+		k.keysMock = func() ([]string, error) { return []string{"foo"}, nil }
+		k.hasMock = func(string) (bool, error) { return true, nil }
+		k.statMock = func(key string) (KeyInfo, error) { return KeyInfo{Key: key}, nil }
+
+		b, err := r.load("foo")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("bar"), b)
+		keys, err := r.keys()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"foo"}, keys)
+		ok, err := r.has("foo")
+		require.NoError(t, err)
+		assert.True(t, ok)
+		info, err := r.stat("foo")
+		require.NoError(t, err)
+		assert.Equal(t, "foo", info.Key)
+	})
+
+	t.Run("with context", func(t *testing.T) {
+		defer k.reset()
+		ctx := context.Background()
+		k.withMock = func(c context.Context) kvs {
+			assert.Equal(t, ctx, c)
+			return k
+		}
+		assert.ErrorIs(t, r.with(ctx).store("foo", nil), ErrReadOnly)
+	})
+
+}
+
+func Test_ReadOnlyMode(t *testing.T) {
+
+	// snapshot returns the names of all the files under dir
+	snapshot := func(t *testing.T, dir string) []string {
+		var names []string
+		require.NoError(t, filepath.WalkDir(dir, func(name string, d iofs.DirEntry, err error) error {
+			names = append(names, name)
+			return err
+		}))
+		return names
+	}
+
+	t.Run("missing root directory", func(t *testing.T) {
+		root := path.Join(t.TempDir(), "root")
+		_, err := Open(Defaults().WithRootDir(root).WithReadOnly())
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		_, err = os.Stat(root)
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("nothing is written", func(t *testing.T) {
+		root := t.TempDir()
+		rw, err := Open(Defaults().WithRootDir(root))
+		require.NoError(t, err)
+		require.NoError(t, rw.StoreString("foo", "bar"))
+		require.NoError(t, rw.StoreWithTTL("old", []byte("old"), time.Millisecond))
+		_, err = rw.Bucket("bucket")
+		require.NoError(t, err)
+		require.NoError(t, rw.Close())
+		// leftovers of an interrupted commit and write
+		require.NoError(t, os.WriteFile(path.Join(root, journal), []byte("journal"), 0644))
+		tmp := path.Join(root, tmpPrefix+"foo-1")
+		require.NoError(t, os.WriteFile(tmp, nil, 0644))
+		old := time.Now().Add(-2 * tmpMaxAge)
+		require.NoError(t, os.Chtimes(tmp, old, old))
+		time.Sleep(5 * time.Millisecond)
+		before := snapshot(t, root)
+
+		pico, err := Open(Defaults().WithRootDir(root).WithReadOnly().WithLocking().WithReaper(time.Millisecond))
+		require.NoError(t, err)
+		defer pico.Close()
+
+		s, err := pico.LoadString("foo")
+		require.NoError(t, err)
+		assert.Equal(t, "bar", s)
+		_, err = pico.Load("old")
+		assert.ErrorIs(t, err, NewKeyNotFound("old"))
+		keys, err := pico.Keys()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"foo"}, keys)
+
+		assert.ErrorIs(t, pico.StoreString("foo", "baz"), ErrReadOnly)
+		assert.ErrorIs(t, pico.Delete("foo"), ErrReadOnly)
+		assert.ErrorIs(t, pico.Txn(func(tx *Tx) error {
+			tx.Delete("foo")
+			return nil
+		}), ErrReadOnly)
+		_, err = pico.StoreIfAbsent("new", nil)
+		assert.ErrorIs(t, err, ErrReadOnly)
+		assert.ErrorIs(t, pico.Persist("foo"), ErrReadOnly)
+		assert.ErrorIs(t, pico.Reap(), ErrReadOnly)
+		assert.ErrorIs(t, pico.DeleteBucket("bucket"), ErrReadOnly)
+
+		b, err := pico.Bucket("missing")
+		require.NoError(t, err)
+		assert.ErrorIs(t, b.StoreString("foo", "bar"), ErrReadOnly)
+
+		time.Sleep(5 * time.Millisecond) // the reaper does not run
+		assert.Equal(t, before, snapshot(t, root))
+	})
+
+}
@@ -0,0 +1,93 @@
+package picodb
+
+import (
+	"container/heap"
+	"sort"
+	"strings"
+)
+
+// Page is a page of keys in lexicographic order, as returned
+// by Scan and Range.
+type Page struct {
+	Keys []string // keys on this page
+	Next string   // cursor of the next page, empty on the last page
+}
+
+// Scan returns the keys starting with the given prefix in
+// lexicographic order.
+// At most limit keys are returned, a limit of zero or less
+// means no limit. The scan starts after the given cursor,
+// which is either empty or the Next field of a previous Page.
+// Since the files of the keys are not stored in order, every call
+// lists all the keys of the store, so paging through n keys with
+// pages of k keys reads O(n*n/k) names. Use Keys or ForEach to
+// visit all the keys at once.
+func (p *PicoDb) Scan(prefix string, limit int, cursor string) (*Page, error) {
+	return p.scan(func(key string) bool {
+		return strings.HasPrefix(key, prefix)
+	}, limit, cursor)
+}
+
+// Range returns the keys in the range [start, end) in
+// lexicographic order. An empty end means the range is unbounded.
+// The limit and cursor work the same way as for Scan, and so does
+// the cost of paging.
+func (p *PicoDb) Range(start, end string, limit int, cursor string) (*Page, error) {
+	return p.scan(func(key string) bool {
+		return key >= start && (end == "" || key < end)
+	}, limit, cursor)
+}
+
+// scan collects the sorted keys matching fn after the cursor.
+// Only the keys of the page are sorted, the rest are dropped
+// as they are found.
+func (p *PicoDb) scan(fn func(string) bool, limit int, cursor string) (*Page, error) {
+	keys, err := p.Keys()
+	if err != nil {
+		return nil, err
+	}
+	matched := []string{}
+	for _, key := range keys {
+		if key > cursor && fn(key) {
+			matched = append(matched, key)
+		}
+	}
+	if limit > 0 && len(matched) > limit+1 {
+		matched = smallest(matched, limit+1)
+	}
+	sort.Strings(matched)
+	page := &Page{Keys: matched}
+	if limit > 0 && len(matched) > limit {
+		page.Keys = matched[:limit]
+		page.Next = matched[limit-1]
+	}
+	return page, nil
+}
+
+// smallest returns the n smallest of the given keys in no particular
+// order, reusing the slice of the keys.
+func smallest(keys []string, n int) []string {
+	h := maxHeap(keys[:n])
+	heap.Init(&h)
+	for _, key := range keys[n:] {
+		if key < h[0] {
+			h[0] = key
+			heap.Fix(&h, 0)
+		}
+	}
+	return h
+}
+
+// maxHeap is a heap of keys with the largest key on the top.
+type maxHeap []string
+
+func (h maxHeap) Len() int            { return len(h) }
+func (h maxHeap) Less(i, j int) bool  { return h[i] > h[j] }
+func (h maxHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(x interface{}) { *h = append(*h, x.(string)) }
+func (h *maxHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
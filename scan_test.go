@@ -0,0 +1,128 @@
+package picodb
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Scan(t *testing.T) {
+
+	s := &testKvs{
+		keysMock: func() ([]string, error) {
+			return []string{"user:3", "item:1", "user:1", "user:2", "item:2"}, nil
+		},
+	}
+	pico := &PicoDb{
+		kvs: s,
+	}
+
+	t.Run("scan prefix", func(t *testing.T) {
+		page, err := pico.Scan("user:", 0, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user:1", "user:2", "user:3"}, page.Keys)
+		assert.Empty(t, page.Next)
+	})
+
+	t.Run("scan empty prefix", func(t *testing.T) {
+		page, err := pico.Scan("", 0, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"item:1", "item:2", "user:1", "user:2", "user:3"}, page.Keys)
+	})
+
+	t.Run("scan no match", func(t *testing.T) {
+		page, err := pico.Scan("missing", 0, "")
+		require.NoError(t, err)
+		assert.Empty(t, page.Keys)
+		assert.Empty(t, page.Next)
+	})
+
+	t.Run("scan pages", func(t *testing.T) {
+		page, err := pico.Scan("user:", 2, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user:1", "user:2"}, page.Keys)
+		assert.Equal(t, "user:2", page.Next)
+
+		page, err = pico.Scan("user:", 2, page.Next)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user:3"}, page.Keys)
+		assert.Empty(t, page.Next)
+	})
+
+	t.Run("exact page has no next", func(t *testing.T) {
+		page, err := pico.Scan("user:", 3, "")
+		require.NoError(t, err)
+		assert.Len(t, page.Keys, 3)
+		assert.Empty(t, page.Next)
+	})
+
+	t.Run("range", func(t *testing.T) {
+		page, err := pico.Range("item:2", "user:3", 0, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"item:2", "user:1", "user:2"}, page.Keys)
+	})
+
+	t.Run("unbounded range", func(t *testing.T) {
+		page, err := pico.Range("user:2", "", 0, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user:2", "user:3"}, page.Keys)
+	})
+
+	t.Run("range pages", func(t *testing.T) {
+		page, err := pico.Range("item:", "user:", 1, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"item:1"}, page.Keys)
+		assert.Equal(t, "item:1", page.Next)
+
+		page, err = pico.Range("item:", "user:", 1, page.Next)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"item:2"}, page.Keys)
+		assert.Empty(t, page.Next)
+	})
+
+	t.Run("pages of many keys", func(t *testing.T) {
+		var all []string
+		for i := 0; i < 1000; i++ {
+			all = append(all, fmt.Sprintf("key:%03d", (i*337)%1000))
+		}
+		pico := &PicoDb{
+			kvs: &testKvs{
+				keysMock: func() ([]string, error) {
+					return append([]string(nil), all...), nil
+				},
+			},
+		}
+		var keys []string
+		page := &Page{}
+		for {
+			var err error
+			page, err = pico.Scan("key:", 7, page.Next)
+			require.NoError(t, err)
+			require.LessOrEqual(t, len(page.Keys), 7)
+			keys = append(keys, page.Keys...)
+			if page.Next == "" {
+				break
+			}
+		}
+		sort.Strings(all)
+		assert.Equal(t, all, keys)
+	})
+
+	t.Run("keys error", func(t *testing.T) {
+		testErr := errors.New("test")
+		pico := &PicoDb{
+			kvs: &testKvs{
+				keysMock: func() ([]string, error) {
+					return nil, testErr
+				},
+			},
+		}
+		_, err := pico.Scan("", 0, "")
+		assert.ErrorIs(t, err, testErr)
+	})
+
+}
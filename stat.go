@@ -0,0 +1,24 @@
+package picodb
+
+import "time"
+
+// KeyInfo describes a key and its value, without the value itself.
+type KeyInfo struct {
+	Key        string    // the key
+	Size       int64     // size of the value
+	StoredSize int64     // size of the value at rest
+	ModTime    time.Time // time of the last modification
+	Compressed bool      // the value is compressed at rest
+	Expires    time.Time // expiry time, zero if the key never expires
+}
+
+// Has reports whether the key exists, without loading its value.
+func (p *PicoDb) Has(key string) (bool, error) {
+	return p.kvs.has(key)
+}
+
+// Stat returns information about a key, without loading its value.
+// If the key is missing, an error is returned.
+func (p *PicoDb) Stat(key string) (KeyInfo, error) {
+	return p.kvs.stat(key)
+}
@@ -0,0 +1,51 @@
+package picodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Has(t *testing.T) {
+	s := &testKvs{}
+	pico := &PicoDb{
+		kvs: s,
+	}
+	key := "foo"
+	defer s.reset()
+	s.hasMock = func(k string) (bool, error) {
+		assert.Equal(t, key, k)
+		return true, nil
+	}
+	ok, err := pico.Has(key)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func Test_Stat(t *testing.T) {
+	s := &testKvs{}
+	pico := &PicoDb{
+		kvs: s,
+	}
+	testErr := errors.New("test")
+
+	t.Run("stat key", func(t *testing.T) {
+		defer s.reset()
+		s.statMock = func(k string) (KeyInfo, error) {
+			return KeyInfo{Key: k, Size: 10, StoredSize: 5, Compressed: true}, nil
+		}
+		info, err := pico.Stat("foo")
+		assert.NoError(t, err)
+		assert.Equal(t, KeyInfo{Key: "foo", Size: 10, StoredSize: 5, Compressed: true}, info)
+	})
+
+	t.Run("stat error", func(t *testing.T) {
+		defer s.reset()
+		s.statMock = func(k string) (KeyInfo, error) {
+			return KeyInfo{}, testErr
+		}
+		_, err := pico.Stat("foo")
+		assert.ErrorIs(t, err, testErr)
+	})
+}
@@ -0,0 +1,40 @@
+package picodb
+
+import "io"
+
+// StoreReader stores a key with the contents of the reader.
+// The contents are streamed to the storage without buffering
+// them in memory.
+func (p *PicoDb) StoreReader(key string, r io.Reader) error {
+	return p.kvs.storeStream(key, r)
+}
+
+// LoadReader opens a key for reading.
+// The caller must close the returned reader.
+// If the key is missing, an error is returned.
+func (p *PicoDb) LoadReader(key string) (io.ReadCloser, error) {
+	return p.kvs.loadStream(key)
+}
+
+// LoadTo copies the value of a key to the writer, and returns
+// the number of bytes copied.
+// If the key is missing, an error is returned.
+func (p *PicoDb) LoadTo(key string, w io.Writer) (int64, error) {
+	rc, err := p.LoadReader(key)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	return io.Copy(w, rc)
+}
+
+// Copy streams the value of the src key into the dst key.
+// If the src key is missing, an error is returned.
+func (p *PicoDb) Copy(dst, src string) error {
+	rc, err := p.LoadReader(src)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return p.StoreReader(dst, rc)
+}
@@ -0,0 +1,66 @@
+package picodb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Stream(t *testing.T) {
+
+	for name, opt := range map[string]*PicoDbOptions{
+		"default":     Defaults(),
+		"compression": Defaults().WithCompression(),
+		"caching":     Defaults().WithCaching().WithLocking(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			pico := New(opt.WithRootDir(t.TempDir()))
+			val := strings.Repeat("stream", 1000)
+
+			require.NoError(t, pico.StoreReader("foo", strings.NewReader(val)))
+
+			rc, err := pico.LoadReader("foo")
+			require.NoError(t, err)
+			b, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+			assert.Equal(t, val, string(b))
+
+			var buf bytes.Buffer
+			n, err := pico.LoadTo("foo", &buf)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(val)), n)
+			assert.Equal(t, val, buf.String())
+
+			require.NoError(t, pico.Copy("bar", "foo"))
+			s, err := pico.LoadString("bar")
+			require.NoError(t, err)
+			assert.Equal(t, val, s)
+
+			_, err = pico.LoadReader("missing")
+			assert.ErrorIs(t, err, NewKeyNotFound("missing"))
+			_, err = pico.LoadTo("missing", &buf)
+			assert.ErrorIs(t, err, NewKeyNotFound("missing"))
+			err = pico.Copy("bar", "missing")
+			assert.ErrorIs(t, err, NewKeyNotFound("missing"))
+		})
+	}
+
+	t.Run("store error", func(t *testing.T) {
+		testErr := errors.New("test")
+		pico := &PicoDb{
+			kvs: &testKvs{
+				storeStreamMock: func(s string, r io.Reader) error {
+					return testErr
+				},
+			},
+		}
+		assert.ErrorIs(t, pico.StoreReader("foo", nil), testErr)
+	})
+
+}
@@ -0,0 +1,50 @@
+package picodb
+
+import "time"
+
+// StoreWithTTL stores a key which expires after the given duration.
+// Expired keys behave as if they were deleted.
+func (p *PicoDb) StoreWithTTL(key string, val []byte, ttl time.Duration) error {
+	return p.kvs.storeTTL(key, val, time.Now().Add(ttl))
+}
+
+// Expire sets an existing key to expire after the given duration.
+// If the key is missing, an error is returned.
+func (p *PicoDb) Expire(key string, ttl time.Duration) error {
+	return p.kvs.expire(key, time.Now().Add(ttl))
+}
+
+// Persist removes the expiry of a key, so that it never expires.
+// If the key is missing, an error is returned.
+func (p *PicoDb) Persist(key string) error {
+	return p.kvs.expire(key, time.Time{})
+}
+
+// Reap deletes the expired keys from the storage.
+// Expired keys are never returned, so reaping is only
+// needed to free up space.
+func (p *PicoDb) Reap() error {
+	return p.kvs.reap()
+}
+
+// reaper calls Reap with the given interval,
+// until the instance is closed.
+func (p *PicoDb) reaper(interval time.Duration) {
+	defer p.wg.Done()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-t.C:
+			_ = p.Reap() // retried on the next tick
+		}
+	}
+}
+
+// expired reports whether the given expiry time has passed.
+// A zero expiry time never passes.
+func expired(exp time.Time) bool {
+	return !exp.IsZero() && !time.Now().Before(exp)
+}
@@ -0,0 +1,161 @@
+package picodb
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_TTL(t *testing.T) {
+
+	for name, opt := range map[string]*PicoDbOptions{
+		"default":     Defaults(),
+		"compression": Defaults().WithCompression(),
+		"caching":     Defaults().WithCaching(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			pico := New(opt.WithRootDir(dir))
+
+			t.Run("live key", func(t *testing.T) {
+				require.NoError(t, pico.StoreWithTTL("live", []byte{1}, time.Hour))
+				val, err := pico.Load("live")
+				require.NoError(t, err)
+				assert.Equal(t, []byte{1}, val)
+				info, err := pico.Stat("live")
+				require.NoError(t, err)
+				assert.WithinDuration(t, time.Now().Add(time.Hour), info.Expires, time.Minute)
+			})
+
+			t.Run("expired key", func(t *testing.T) {
+				require.NoError(t, pico.StoreWithTTL("expired", []byte{1}, -time.Second))
+				_, err := pico.Load("expired")
+				assert.ErrorIs(t, err, NewKeyNotFound("expired"))
+				_, err = pico.LoadReader("expired")
+				assert.ErrorIs(t, err, NewKeyNotFound("expired"))
+				_, err = pico.Stat("expired")
+				assert.ErrorIs(t, err, NewKeyNotFound("expired"))
+				ok, err := pico.Has("expired")
+				require.NoError(t, err)
+				assert.False(t, ok)
+				keys, err := pico.Keys()
+				require.NoError(t, err)
+				assert.NotContains(t, keys, "expired")
+			})
+
+			t.Run("expired key is absent for conditional store", func(t *testing.T) {
+				ok, err := pico.StoreIfAbsent("expired", []byte{2})
+				require.NoError(t, err)
+				assert.True(t, ok)
+				info, err := pico.Stat("expired")
+				require.NoError(t, err)
+				assert.True(t, info.Expires.IsZero())
+			})
+
+			t.Run("store clears expiry", func(t *testing.T) {
+				require.NoError(t, pico.StoreWithTTL("cleared", []byte{1}, time.Hour))
+				require.NoError(t, pico.Store("cleared", []byte{2}))
+				info, err := pico.Stat("cleared")
+				require.NoError(t, err)
+				assert.True(t, info.Expires.IsZero())
+			})
+
+			t.Run("update keeps expiry", func(t *testing.T) {
+				require.NoError(t, pico.StoreWithTTL("kept", []byte{1}, time.Hour))
+				require.NoError(t, pico.Update("kept", func(old []byte, exists bool) ([]byte, error) {
+					return append(old, 2), nil
+				}))
+				info, err := pico.Stat("kept")
+				require.NoError(t, err)
+				assert.False(t, info.Expires.IsZero())
+			})
+
+			t.Run("expire and persist", func(t *testing.T) {
+				require.NoError(t, pico.StoreString("foo", "bar"))
+				require.NoError(t, pico.Expire("foo", time.Hour))
+				info, err := pico.Stat("foo")
+				require.NoError(t, err)
+				assert.False(t, info.Expires.IsZero())
+
+				require.NoError(t, pico.Persist("foo"))
+				info, err = pico.Stat("foo")
+				require.NoError(t, err)
+				assert.True(t, info.Expires.IsZero())
+
+				require.NoError(t, pico.Expire("foo", -time.Second))
+				_, err = pico.Load("foo")
+				assert.ErrorIs(t, err, NewKeyNotFound("foo"))
+
+				err = pico.Expire("foo", time.Hour)
+				assert.ErrorIs(t, err, NewKeyNotFound("foo"))
+				err = pico.Expire("missing", time.Hour)
+				assert.ErrorIs(t, err, NewKeyNotFound("missing"))
+			})
+
+			t.Run("expiry survives restart", func(t *testing.T) {
+				require.NoError(t, pico.StoreWithTTL("restart", []byte{1}, -time.Second))
+				other := New(opt)
+				_, err := other.Load("restart")
+				assert.ErrorIs(t, err, NewKeyNotFound("restart"))
+			})
+
+			t.Run("reap", func(t *testing.T) {
+				require.NoError(t, pico.StoreWithTTL("reaped", []byte{1}, -time.Second))
+				require.NoError(t, pico.Reap())
+				assert.NoFileExists(t, path.Join(dir, "reaped"))
+				assert.NoFileExists(t, path.Join(dir, ttlDir, "reaped"))
+				assert.FileExists(t, path.Join(dir, "live"))
+				assert.FileExists(t, path.Join(dir, ttlDir, "live"))
+			})
+
+			t.Run("delete removes expiry", func(t *testing.T) {
+				require.NoError(t, pico.Delete("live"))
+				assert.NoFileExists(t, path.Join(dir, ttlDir, "live"))
+			})
+		})
+	}
+
+	t.Run("background reaper", func(t *testing.T) {
+		dir := t.TempDir()
+		pico := New(Defaults().WithRootDir(dir).WithReaper(10 * time.Millisecond))
+		require.NoError(t, pico.StoreWithTTL("foo", []byte{1}, 50*time.Millisecond))
+		assert.Eventually(t, func() bool {
+			_, err := os.Stat(path.Join(dir, "foo"))
+			return os.IsNotExist(err)
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("stale temp files of expiry times are removed on open", func(t *testing.T) {
+		dir := t.TempDir()
+		stale := path.Join(dir, ttlDir, tmpPrefix+"1")
+		require.NoError(t, os.MkdirAll(path.Dir(stale), 0755))
+		require.NoError(t, os.WriteFile(stale, nil, 0644))
+		old := time.Now().Add(-2 * tmpMaxAge)
+		require.NoError(t, os.Chtimes(stale, old, old))
+		pico, err := Open(Defaults().WithRootDir(dir))
+		require.NoError(t, err)
+		defer pico.Close()
+		assert.NoFileExists(t, stale)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		testErr := errors.New("test")
+		pico := &PicoDb{
+			kvs: &testKvs{
+				storeTTLMock: func(s string, b []byte, exp time.Time) error { return testErr },
+				expireMock:   func(s string, exp time.Time) error { return testErr },
+				reapMock:     func() error { return testErr },
+			},
+		}
+		assert.ErrorIs(t, pico.StoreWithTTL("foo", nil, time.Hour), testErr)
+		assert.ErrorIs(t, pico.Expire("foo", time.Hour), testErr)
+		assert.ErrorIs(t, pico.Persist("foo"), testErr)
+		assert.ErrorIs(t, pico.Reap(), testErr)
+	})
+
+}
@@ -0,0 +1,106 @@
+package picodb
+
+import "context"
+
+// Tx stages the changes of a transaction.
+// A Tx is only valid inside the function passed to Txn.
+type Tx struct {
+	p   *PicoDb
+	ops []op
+	idx map[string]int // index of the staged change of each key
+}
+
+// Txn runs fn with a new transaction, and commits the changes staged
+// in it when fn returns. Either all or none of the changes are applied,
+// even if the process crashes during the commit.
+// With a custom Backend, which has no journal, the changes are rolled
+// back if one of them fails, but a crash during the commit may leave
+// part of them applied, as may a failed rollback, whose error is
+// returned together with the error of the commit.
+// If fn returns an error, the changes are discarded and the error
+// is returned.
+func (p *PicoDb) Txn(fn func(tx *Tx) error) error {
+	return p.TxnContext(context.Background(), fn)
+}
+
+// TxnContext runs a transaction, like Txn.
+// If the context is done before the changes are committed, they are
+// discarded and the error of the context is returned. Once the
+// commit has started, the changes are applied even if the context
+// is done meanwhile, and they are applied or rolled back as a whole,
+// as described at Txn.
+func (p *PicoDb) TxnContext(ctx context.Context, fn func(tx *Tx) error) error {
+	if err := p.check(); err != nil {
+		return err
+	}
+	tx := &Tx{
+		p:   p,
+		idx: make(map[string]int),
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if len(tx.ops) == 0 {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.kvs.with(ctx).commit(tx.ops)
+}
+
+// Store stages storing a key.
+func (tx *Tx) Store(key string, val []byte) {
+	tx.stage(op{Key: key, Val: val})
+}
+
+// StoreString stages storing a key with a string value.
+func (tx *Tx) StoreString(key, val string) {
+	tx.Store(key, []byte(val))
+}
+
+// Delete stages deleting a key.
+func (tx *Tx) Delete(key string) {
+	tx.stage(op{Key: key, Del: true})
+}
+
+// Load a key, as seen by the transaction.
+// Changes staged in the transaction are taken into account.
+// If the key is missing, an error is returned.
+func (tx *Tx) Load(key string) ([]byte, error) {
+	if i, ok := tx.idx[key]; ok {
+		if tx.ops[i].Del {
+			return nil, NewKeyNotFound(key)
+		}
+		return tx.ops[i].Val, nil
+	}
+	return tx.p.Load(key)
+}
+
+// LoadString loads a key with a string value, as seen by the transaction.
+// If the key is missing, an error is returned.
+func (tx *Tx) LoadString(key string) (string, error) {
+	b, err := tx.Load(key)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Has reports whether the key exists, as seen by the transaction.
+func (tx *Tx) Has(key string) (bool, error) {
+	if i, ok := tx.idx[key]; ok {
+		return !tx.ops[i].Del, nil
+	}
+	return tx.p.Has(key)
+}
+
+// stage a change, replacing an earlier change of the same key.
+func (tx *Tx) stage(o op) {
+	if i, ok := tx.idx[o.Key]; ok {
+		tx.ops[i] = o
+		return
+	}
+	tx.idx[o.Key] = len(tx.ops)
+	tx.ops = append(tx.ops, o)
+}
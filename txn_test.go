@@ -0,0 +1,256 @@
+package picodb
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Txn(t *testing.T) {
+
+	pico := &PicoDb{
+		kvs: &cache{m: &sync.Map{}},
+	}
+	testErr := errors.New("test")
+
+	t.Run("commit changes", func(t *testing.T) {
+		require.NoError(t, pico.StoreString("old", "x"))
+		err := pico.Txn(func(tx *Tx) error {
+			tx.StoreString("index", "record")
+			tx.StoreString("record", "data")
+			tx.Delete("old")
+			return nil
+		})
+		require.NoError(t, err)
+
+		val, err := pico.LoadString("index")
+		require.NoError(t, err)
+		assert.Equal(t, "record", val)
+		val, err = pico.LoadString("record")
+		require.NoError(t, err)
+		assert.Equal(t, "data", val)
+		_, err = pico.Load("old")
+		assert.ErrorIs(t, err, NewKeyNotFound("old"))
+	})
+
+	t.Run("discard changes on error", func(t *testing.T) {
+		err := pico.Txn(func(tx *Tx) error {
+			tx.StoreString("discarded", "x")
+			return testErr
+		})
+		assert.ErrorIs(t, err, testErr)
+		_, err = pico.Load("discarded")
+		assert.ErrorIs(t, err, NewKeyNotFound("discarded"))
+	})
+
+	t.Run("load staged changes", func(t *testing.T) {
+		require.NoError(t, pico.StoreString("foo", "bar"))
+		err := pico.Txn(func(tx *Tx) error {
+			val, err := tx.LoadString("foo")
+			require.NoError(t, err)
+			assert.Equal(t, "bar", val)
+
+			tx.StoreString("foo", "baz")
+			val, err = tx.LoadString("foo")
+			require.NoError(t, err)
+			assert.Equal(t, "baz", val)
+
+			tx.Delete("foo")
+			_, err = tx.Load("foo")
+			assert.ErrorIs(t, err, NewKeyNotFound("foo"))
+			ok, err := tx.Has("foo")
+			require.NoError(t, err)
+			assert.False(t, ok)
+			return nil
+		})
+		require.NoError(t, err)
+		ok, err := pico.Has("foo")
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("empty transaction", func(t *testing.T) {
+		pico := &PicoDb{
+			kvs: &testKvs{
+				commitMock: func(ops []op) error {
+					t.Fail()
+					return nil
+				},
+			},
+		}
+		assert.NoError(t, pico.Txn(func(tx *Tx) error { return nil }))
+	})
+
+	t.Run("commit error", func(t *testing.T) {
+		pico := &PicoDb{
+			kvs: &testKvs{
+				commitMock: func(ops []op) error {
+					assert.Equal(t, []op{{Key: "foo", Val: []byte{1}}}, ops)
+					return testErr
+				},
+			},
+		}
+		err := pico.Txn(func(tx *Tx) error {
+			tx.Store("foo", []byte{0})
+			tx.Store("foo", []byte{1})
+			return nil
+		})
+		assert.ErrorIs(t, err, testErr)
+	})
+
+}
+
+func Test_TxnJournal(t *testing.T) {
+
+	t.Run("commit on disk", func(t *testing.T) {
+		dir := t.TempDir()
+		pico := New(Defaults().WithRootDir(dir))
+		err := pico.Txn(func(tx *Tx) error {
+			tx.StoreString("foo", "1")
+			tx.StoreString("bar", "2")
+			return nil
+		})
+		require.NoError(t, err)
+		assert.NoFileExists(t, path.Join(dir, journal))
+		keys, err := pico.Keys()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"foo", "bar"}, keys)
+	})
+
+	t.Run("replay after crash", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(path.Join(dir, "old"), []byte{}, 0644))
+
+		var buf bytes.Buffer
+		ops := []op{{Key: "foo", Val: []byte("1")}, {Key: "old", Del: true}}
+		require.NoError(t, gob.NewEncoder(&buf).Encode(ops))
+		require.NoError(t, os.WriteFile(path.Join(dir, journal), buf.Bytes(), 0644))
+
+		pico := New(Defaults().WithRootDir(dir))
+		assert.NoFileExists(t, path.Join(dir, journal))
+		val, err := pico.LoadString("foo")
+		require.NoError(t, err)
+		assert.Equal(t, "1", val)
+		ok, err := pico.Has("old")
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("replay compressed journal", func(t *testing.T) {
+		dir := t.TempDir()
+		d := newDirfs(Defaults().WithRootDir(dir).WithCompression())
+		var buf bytes.Buffer
+		require.NoError(t, gob.NewEncoder(&buf).Encode([]op{{Key: "foo", Val: []byte("1")}}))
+		require.NoError(t, d.s.write(path.Join(dir, journal), buf.Bytes()))
+
+		pico := New(Defaults().WithRootDir(dir).WithCompression())
+		val, err := pico.LoadString("foo")
+		require.NoError(t, err)
+		assert.Equal(t, "1", val)
+	})
+
+	t.Run("failed replay is finished by the next commit", func(t *testing.T) {
+		dir := t.TempDir()
+		pico := New(Defaults().WithRootDir(dir))
+		// a directory in place of b makes applying its change fail
+		require.NoError(t, os.Mkdir(path.Join(dir, "b"), 0755))
+		err := pico.Txn(func(tx *Tx) error {
+			tx.StoreString("a", "1")
+			tx.StoreString("b", "2")
+			return nil
+		})
+		require.Error(t, err)
+		assert.FileExists(t, path.Join(dir, journal))
+
+		require.NoError(t, os.Remove(path.Join(dir, "b")))
+		require.NoError(t, pico.Txn(func(tx *Tx) error {
+			tx.StoreString("c", "3")
+			return nil
+		}))
+		assert.NoFileExists(t, path.Join(dir, journal))
+		require.NoError(t, pico.Close())
+
+		pico = New(Defaults().WithRootDir(dir))
+		defer pico.Close()
+		vals, err := pico.LoadMany([]string{"a", "b", "c"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]byte{"a": []byte("1"), "b": []byte("2"), "c": []byte("3")}, vals)
+	})
+
+	t.Run("failed commit does not leave stale values in the cache", func(t *testing.T) {
+		dir := t.TempDir()
+		pico := New(Defaults().WithRootDir(dir).WithCaching())
+		defer pico.Close()
+		require.NoError(t, pico.StoreString("a", "0"))
+		require.NoError(t, os.Mkdir(path.Join(dir, "b"), 0755))
+		err := pico.Txn(func(tx *Tx) error {
+			tx.StoreString("a", "1")
+			tx.StoreString("b", "2")
+			return nil
+		})
+		require.Error(t, err)
+		val, err := pico.LoadString("a")
+		require.NoError(t, err)
+		assert.Equal(t, "1", val)
+	})
+
+	t.Run("torn journal is discarded", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, gob.NewEncoder(&buf).Encode([]op{{Key: "foo", Val: []byte("1")}}))
+		for name, b := range map[string][]byte{
+			"empty":     {},
+			"truncated": buf.Bytes()[:buf.Len()/2],
+			"junk":      []byte("junk"),
+		} {
+			t.Run(name, func(t *testing.T) {
+				for _, compressed := range []bool{false, true} {
+					dir := t.TempDir()
+					require.NoError(t, os.WriteFile(path.Join(dir, journal), b, 0644))
+					opt := Defaults().WithRootDir(dir)
+					if compressed {
+						opt = opt.WithCompression()
+					}
+					pico, err := Open(opt)
+					require.NoError(t, err)
+					assert.NoFileExists(t, path.Join(dir, journal))
+					has, err := pico.Has("foo")
+					require.NoError(t, err)
+					assert.False(t, has)
+					require.NoError(t, pico.Txn(func(tx *Tx) error {
+						tx.StoreString("bar", "2")
+						return nil
+					}))
+					require.NoError(t, pico.Close())
+				}
+			})
+		}
+	})
+
+	t.Run("torn journal is discarded by the next commit", func(t *testing.T) {
+		dir := t.TempDir()
+		pico := New(Defaults().WithRootDir(dir))
+		defer pico.Close()
+		require.NoError(t, os.WriteFile(path.Join(dir, journal), nil, 0644))
+		require.NoError(t, pico.Txn(func(tx *Tx) error {
+			tx.StoreString("foo", "1")
+			return nil
+		}))
+		assert.NoFileExists(t, path.Join(dir, journal))
+		s, err := pico.LoadString("foo")
+		require.NoError(t, err)
+		assert.Equal(t, "1", s)
+	})
+
+	t.Run("missing journal", func(t *testing.T) {
+		d := newDirfs(Defaults().WithRootDir(path.Join(t.TempDir(), "missing")))
+		assert.NoError(t, d.recover())
+	})
+
+}
@@ -0,0 +1,101 @@
+package picodb
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Typed is a collection of values of type T stored in a KV, such as
+// a PicoDb or one of its buckets.
+// Values are encoded with the codec of the PicoDb options.
+// A collection may be scoped to a key prefix, in which case its
+// keys are stored with the prefix, and it only sees the keys with
+// the prefix.
+type Typed[T any] struct {
+	db     KV
+	prefix string
+}
+
+// NewTyped returns a collection of values of type T stored in db.
+// The keys of the collection are stored with the given prefix,
+// an empty prefix makes all keys of db part of the collection.
+func NewTyped[T any](db KV, prefix string) *Typed[T] {
+	return &Typed[T]{
+		db:     db,
+		prefix: prefix,
+	}
+}
+
+// Put stores a value.
+func (t *Typed[T]) Put(key string, v T) error {
+	return t.db.StoreValue(t.key(key), v)
+}
+
+// Get loads a value.
+// If the key is missing, an error is returned.
+func (t *Typed[T]) Get(key string) (T, error) {
+	var v T
+	if err := t.db.LoadValue(t.key(key), &v); err != nil {
+		var zero T
+		return zero, err
+	}
+	return v, nil
+}
+
+// Delete a key.
+func (t *Typed[T]) Delete(key string) error {
+	return t.db.Delete(t.key(key))
+}
+
+// Has reports whether the key exists.
+func (t *Typed[T]) Has(key string) (bool, error) {
+	return t.db.Has(t.key(key))
+}
+
+// Keys returns the keys of the collection in lexicographic order,
+// without the prefix.
+func (t *Typed[T]) Keys() ([]string, error) {
+	all, err := t.db.Keys()
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for _, key := range all {
+		if strings.HasPrefix(key, t.prefix) {
+			keys = append(keys, strings.TrimPrefix(key, t.prefix))
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// ForEach calls fn for every key-value pair of the collection,
+// in lexicographic order of the keys.
+// Keys deleted while iterating are skipped.
+// If fn returns an error, or a value cannot be decoded,
+// the iteration stops and the error is returned.
+func (t *Typed[T]) ForEach(fn func(key string, v T) error) error {
+	keys, err := t.Keys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		v, err := t.Get(key)
+		if err != nil {
+			if errors.Is(err, NewKeyNotFound(t.key(key))) {
+				continue
+			}
+			return err
+		}
+		if err := fn(key, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// key returns the key of the PicoDb for a key of the collection.
+func (t *Typed[T]) key(key string) string {
+	return t.prefix + key
+}
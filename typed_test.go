@@ -0,0 +1,95 @@
+package picodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Typed(t *testing.T) {
+
+	pico := New(Defaults().WithRootDir(t.TempDir()))
+	users := NewTyped[testValue](pico, "user:")
+	counts := NewTyped[int](pico, "")
+
+	t.Run("put and get", func(t *testing.T) {
+		in := testValue{Name: "foo", Count: 1}
+		require.NoError(t, users.Put("1", in))
+		out, err := users.Get("1")
+		require.NoError(t, err)
+		assert.Equal(t, in, out)
+
+		var raw testValue
+		require.NoError(t, pico.LoadValue("user:1", &raw))
+		assert.Equal(t, in, raw)
+	})
+
+	t.Run("get missing key", func(t *testing.T) {
+		out, err := users.Get("missing")
+		assert.ErrorIs(t, err, NewKeyNotFound("user:missing"))
+		assert.Equal(t, testValue{}, out)
+	})
+
+	t.Run("keys are scoped to the prefix", func(t *testing.T) {
+		require.NoError(t, users.Put("2", testValue{Name: "bar"}))
+		require.NoError(t, pico.StoreValue("other", 42))
+		keys, err := users.Keys()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"1", "2"}, keys)
+
+		has, err := users.Has("other")
+		require.NoError(t, err)
+		assert.False(t, has)
+		has, err = counts.Has("other")
+		require.NoError(t, err)
+		assert.True(t, has)
+	})
+
+	t.Run("for each", func(t *testing.T) {
+		var names []string
+		err := users.ForEach(func(key string, v testValue) error {
+			names = append(names, key+"="+v.Name)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"1=foo", "2=bar"}, names)
+	})
+
+	t.Run("for each error", func(t *testing.T) {
+		testErr := errors.New("test")
+		err := users.ForEach(func(key string, v testValue) error {
+			return testErr
+		})
+		assert.ErrorIs(t, err, testErr)
+	})
+
+	t.Run("for each decoding error", func(t *testing.T) {
+		err := counts.ForEach(func(key string, v int) error {
+			return nil
+		})
+		var ce CodecError
+		assert.True(t, errors.As(err, &ce))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, users.Delete("1"))
+		_, err := users.Get("1")
+		assert.ErrorIs(t, err, NewKeyNotFound("user:1"))
+	})
+
+	t.Run("bucket", func(t *testing.T) {
+		b, err := pico.Bucket("users")
+		require.NoError(t, err)
+		users := NewTyped[testValue](b, "")
+		require.NoError(t, users.Put("3", testValue{Name: "baz"}))
+		keys, err := users.Keys()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"3"}, keys)
+		has, err := pico.Has("3")
+		require.NoError(t, err)
+		assert.False(t, has)
+	})
+
+}
@@ -0,0 +1,122 @@
+package picodb
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventOp is the kind of change reported by an Event.
+type EventOp int
+
+const (
+	EventPut    EventOp = iota // the key was stored
+	EventDelete                // the key was deleted
+)
+
+func (o EventOp) String() string {
+	switch o {
+	case EventPut:
+		return "put"
+	case EventDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// Event is a change of a key reported by Watch.
+type Event struct {
+	Op   EventOp   // the kind of change
+	Key  string    // the changed key
+	Time time.Time // time the change was observed
+}
+
+// watchBuffer is the number of events buffered for each watcher.
+const watchBuffer = 128
+
+// Watch returns a channel which receives the changes of the keys
+// with the given prefix. An empty prefix watches all keys.
+// The channel is closed when the context is done, or the instance
+// is closed.
+// By default only the changes made through this instance are
+// reported. If the options enable watching the root directory,
+// the changes made by other instances and processes are reported
+// as well. Watching the root directory returns ErrNotSupported
+// without a root directory, or with sharding.
+// Events are dropped if the receiver does not keep up with them.
+// Expired keys are not reported until they are deleted.
+func (p *PicoDb) Watch(ctx context.Context, prefix string) (<-chan Event, error) {
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	if p.opt.WatchRoot {
+		if !p.opt.rooted() || p.opt.ShardDepth > 0 {
+			return nil, ErrNotSupported
+		}
+		if err := p.watchRoot(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.spawn(1); err != nil {
+		return nil, err
+	}
+	ch := p.hub.subscribe(prefix)
+	go func() {
+		defer p.wg.Done()
+		select {
+		case <-ctx.Done():
+		case <-p.done:
+		}
+		p.hub.unsubscribe(ch)
+	}()
+	return ch, nil
+}
+
+// hub distributes events to the watchers.
+type hub struct {
+	mu   sync.Mutex
+	subs map[chan Event]string // the watched prefix of each watcher
+}
+
+func newHub() *hub {
+	return &hub{subs: make(map[chan Event]string)}
+}
+
+// subscribe returns a new channel receiving the events of the
+// keys with the given prefix.
+func (h *hub) subscribe(prefix string) chan Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch := make(chan Event, watchBuffer)
+	h.subs[ch] = prefix
+	return ch
+}
+
+// unsubscribe removes and closes the given channel.
+func (h *hub) unsubscribe(ch chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, ch)
+	close(ch)
+}
+
+// publish sends an event to the watchers of the key, without
+// waiting for the watchers which are not ready to receive it.
+func (h *hub) publish(op EventOp, key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.subs) == 0 {
+		return
+	}
+	ev := Event{Op: op, Key: key, Time: time.Now()}
+	for ch, prefix := range h.subs {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
@@ -0,0 +1,100 @@
+//go:build linux
+// +build linux
+
+package picodb
+
+import (
+	"os"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// rootEvents are the inotify events watched in the root directory.
+// Values are renamed into place, so a put is reported as a move,
+// while files written in place by other tools are reported when
+// they are closed.
+const rootEvents = unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_DELETE | unix.IN_MOVED_FROM
+
+// watchRoot starts watching the root directory with inotify, unless
+// it is already watched. The changes of the files in the root
+// directory are published until the instance is closed.
+func (p *PicoDb) watchRoot() error {
+	p.wmu.Lock()
+	defer p.wmu.Unlock()
+	if p.watching {
+		return nil
+	}
+	if !p.opt.ReadOnly {
+		if err := newDirfs(p.opt).mkroot(); err != nil {
+			return err
+		}
+	}
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return os.NewSyscallError("inotify_init1", err)
+	}
+	// a non-blocking file is read through the runtime poller,
+	// so closing it interrupts the pending read
+	f := os.NewFile(uintptr(fd), "inotify")
+	if _, err := unix.InotifyAddWatch(fd, p.opt.RootDir, rootEvents); err != nil {
+		f.Close()
+		return os.NewSyscallError("inotify_add_watch", err)
+	}
+	if err := p.spawn(2); err != nil {
+		f.Close()
+		return err
+	}
+	p.watching = true
+	go func() {
+		defer p.wg.Done()
+		<-p.done
+		f.Close()
+	}()
+	go func() {
+		defer p.wg.Done()
+		p.readEvents(f)
+	}()
+	return nil
+}
+
+// readEvents publishes the events read from the inotify file,
+// until reading from it fails.
+func (p *PicoDb) readEvents(f *os.File) {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			return
+		}
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			off += unix.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[off:off+int(ev.Len)]), "\x00")
+			off += int(ev.Len)
+			op, ok := inotifyOp(ev.Mask, name)
+			if !ok {
+				continue
+			}
+			if key, err := p.opt.KeyEncoding.decode(name); err == nil {
+				p.hub.publish(op, key)
+			}
+		}
+	}
+}
+
+// inotifyOp maps an inotify event of the root directory to an EventOp.
+// Reports false for events which do not concern a key.
+func inotifyOp(mask uint32, name string) (EventOp, bool) {
+	if name == "" || internal(name) || mask&unix.IN_ISDIR != 0 {
+		return 0, false
+	}
+	switch {
+	case mask&(unix.IN_CLOSE_WRITE|unix.IN_MOVED_TO) != 0:
+		return EventPut, true
+	case mask&(unix.IN_DELETE|unix.IN_MOVED_FROM) != 0:
+		return EventDelete, true
+	}
+	return 0, false
+}
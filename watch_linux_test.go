@@ -0,0 +1,76 @@
+//go:build linux
+// +build linux
+
+package picodb
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func Test_WatchRoot(t *testing.T) {
+
+	t.Run("changes of other instances are reported", func(t *testing.T) {
+		dir := t.TempDir()
+		for name, opt := range map[string]*PicoDbOptions{
+			"default":     Defaults(),
+			"compression": Defaults().WithCompression(),
+		} {
+			t.Run(name, func(t *testing.T) {
+				watcher := New(opt.WithRootDir(dir).WithRootWatch())
+				defer watcher.Close()
+				ch, err := watcher.Watch(context.Background(), "")
+				require.NoError(t, err)
+
+				writer := New(Defaults().WithRootDir(dir))
+				require.NoError(t, writer.StoreWithTTL("foo", []byte("bar"), 1<<40))
+				require.NoError(t, writer.Delete("foo"))
+				require.NoError(t, os.WriteFile(path.Join(dir, "baz"), nil, 0644))
+
+				for _, want := range []Event{
+					{Op: EventPut, Key: "foo"},
+					{Op: EventDelete, Key: "foo"},
+					{Op: EventPut, Key: "baz"},
+				} {
+					ev := receive(t, ch)
+					assert.Equal(t, want.Op, ev.Op)
+					assert.Equal(t, want.Key, ev.Key)
+				}
+			})
+		}
+	})
+
+	t.Run("own changes are reported once", func(t *testing.T) {
+		pico := New(Defaults().WithRootDir(t.TempDir()).WithRootWatch())
+		ch, err := pico.Watch(context.Background(), "")
+		require.NoError(t, err)
+		require.NoError(t, pico.StoreString("foo", "bar"))
+		require.NoError(t, pico.StoreString("bar", "baz"))
+		assert.Equal(t, "foo", receive(t, ch).Key)
+		assert.Equal(t, "bar", receive(t, ch).Key)
+		require.NoError(t, pico.Close())
+		assertClosed(t, ch)
+	})
+
+	t.Run("inotify events", func(t *testing.T) {
+		op, ok := inotifyOp(unix.IN_MOVED_TO, "foo")
+		assert.True(t, ok)
+		assert.Equal(t, EventPut, op)
+		op, ok = inotifyOp(unix.IN_DELETE, "foo")
+		assert.True(t, ok)
+		assert.Equal(t, EventDelete, op)
+		_, ok = inotifyOp(unix.IN_CLOSE_WRITE, tmpPrefix+"foo")
+		assert.False(t, ok)
+		_, ok = inotifyOp(unix.IN_MOVED_TO|unix.IN_ISDIR, "foo")
+		assert.False(t, ok)
+		_, ok = inotifyOp(unix.IN_MOVED_TO, "")
+		assert.False(t, ok)
+	})
+
+}
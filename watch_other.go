@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package picodb
+
+// watchRoot is not supported on this platform.
+func (p *PicoDb) watchRoot() error {
+	return ErrNotSupported
+}
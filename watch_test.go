@@ -0,0 +1,110 @@
+package picodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Watch(t *testing.T) {
+
+	t.Run("changes are reported", func(t *testing.T) {
+		pico := New(Defaults().WithRootDir(t.TempDir()).WithCaching())
+		defer pico.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		ch, err := pico.Watch(ctx, "user:")
+		require.NoError(t, err)
+
+		require.NoError(t, pico.StoreString("config", "ignored"))
+		require.NoError(t, pico.StoreString("user:1", "foo"))
+		require.NoError(t, pico.Delete("user:1"))
+		err = pico.Txn(func(tx *Tx) error {
+			tx.StoreString("user:2", "bar")
+			return nil
+		})
+		require.NoError(t, err)
+
+		for _, want := range []Event{
+			{Op: EventPut, Key: "user:1"},
+			{Op: EventDelete, Key: "user:1"},
+			{Op: EventPut, Key: "user:2"},
+		} {
+			ev := receive(t, ch)
+			assert.Equal(t, want.Op, ev.Op)
+			assert.Equal(t, want.Key, ev.Key)
+		}
+	})
+
+	t.Run("channel is closed with the context", func(t *testing.T) {
+		pico := New(Defaults().WithRootDir(t.TempDir()))
+		defer pico.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		ch, err := pico.Watch(ctx, "")
+		require.NoError(t, err)
+		cancel()
+		assertClosed(t, ch)
+	})
+
+	t.Run("channel is closed with the instance", func(t *testing.T) {
+		pico := New(Defaults().WithRootDir(t.TempDir()))
+		ch, err := pico.Watch(context.Background(), "")
+		require.NoError(t, err)
+		require.NoError(t, pico.Close())
+		assertClosed(t, ch)
+		_, err = pico.Watch(context.Background(), "")
+		assert.ErrorIs(t, err, ErrClosed)
+	})
+
+	t.Run("root watch with sharding is not supported", func(t *testing.T) {
+		pico := New(Defaults().WithRootDir(t.TempDir()).WithRootWatch().WithSharding(2, 2))
+		defer pico.Close()
+		_, err := pico.Watch(context.Background(), "")
+		assert.ErrorIs(t, err, ErrNotSupported)
+	})
+
+	t.Run("slow watchers miss events", func(t *testing.T) {
+		h := newHub()
+		ch := h.subscribe("")
+		for i := 0; i < watchBuffer+1; i++ {
+			h.publish(EventPut, "foo")
+		}
+		assert.Len(t, ch, watchBuffer)
+		h.unsubscribe(ch)
+		assert.Empty(t, h.subs)
+	})
+
+	t.Run("event op names", func(t *testing.T) {
+		assert.Equal(t, "put", EventPut.String())
+		assert.Equal(t, "delete", EventDelete.String())
+		assert.Equal(t, "unknown", EventOp(-1).String())
+	})
+
+}
+
+// receive returns the next event of the channel.
+func receive(t *testing.T, ch <-chan Event) Event {
+	t.Helper()
+	select {
+	case ev, ok := <-ch:
+		require.True(t, ok, "channel closed")
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+	}
+	return Event{}
+}
+
+// assertClosed asserts that the channel gets closed.
+func assertClosed(t *testing.T, ch <-chan Event) {
+	t.Helper()
+	select {
+	case _, ok := <-ch:
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("channel not closed")
+	}
+}